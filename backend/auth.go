@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+)
+
+// API key roles, in increasing order of privilege
+const (
+	RoleReader      = "reader"
+	RoleContributor = "contributor"
+	RoleAdmin       = "admin"
+)
+
+var roleRanks = map[string]int{
+	RoleReader:      1,
+	RoleContributor: 2,
+	RoleAdmin:       3,
+}
+
+// Prefix of generated keys, makes them recognizable in configs and logs
+const apiKeyPrefix = "ccl_"
+
+// APIKey is a stored API key; the secret itself is only kept as a hash
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// createAPIKey generates and stores a new key, returning the plaintext
+// secret, which cannot be recovered later
+func createAPIKey(name, role string) (*APIKey, string, error) {
+	if _, ok := roleRanks[role]; !ok {
+		return nil, "", fmt.Errorf("unknown role %q (use reader, contributor or admin)", role)
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("key name is required")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(buf)
+
+	key := &APIKey{
+		ID:        uuid.NewString(),
+		Name:      strings.TrimSpace(name),
+		Role:      role,
+		Prefix:    secret[:len(apiKeyPrefix)+8],
+		CreatedAt: time.Now().UTC(),
+	}
+	_, err := db.Exec(`
+		INSERT INTO api_keys (id, name, role, key_prefix, key_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, key.ID, key.Name, key.Role, key.Prefix, hashAPIKey(secret), key.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+func listAPIKeys() ([]APIKey, error) {
+	rows, err := db.Query("SELECT id, name, role, key_prefix, created_at, last_used_at, revoked_at FROM api_keys ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var lastUsed, revoked sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.CreatedAt, &lastUsed, &revoked); err != nil {
+			return nil, err
+		}
+		if lastUsed.Valid {
+			key.LastUsedAt = &lastUsed.Time
+		}
+		if revoked.Valid {
+			key.RevokedAt = &revoked.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// revokeAPIKey disables a key; revoked keys stay listed for attribution
+func revokeAPIKey(id string) (bool, error) {
+	res, err := db.Exec("UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND revoked_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// lookupAPIKey resolves a plaintext key to an active stored key
+func lookupAPIKey(secret string) (*APIKey, error) {
+	var key APIKey
+	err := db.QueryRow(`
+		SELECT id, name, role, key_prefix, created_at
+		FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL
+	`, hashAPIKey(secret)).Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// apiKeyFromRequest reads the key from X-API-Key or an Authorization bearer token
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	auth := c.GetHeader("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// requireRole rejects requests without an active API key of at least the given role.
+// The authenticated key is available to handlers via currentAPIKey.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorizeRole(c, role) {
+			c.Next()
+		}
+	}
+}
+
+// authorizeRole checks for an active API key of at least the given role,
+// aborting with an error response when there is none. Handlers use it for
+// requests that need a key only in some cases.
+func authorizeRole(c *gin.Context, role string) bool {
+	secret := apiKeyFromRequest(c)
+	if secret == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
+		return false
+	}
+
+	key, err := lookupAPIKey(secret)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return false
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return false
+	}
+	if roleRanks[key.Role] < roleRanks[role] {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + role + " role"})
+		return false
+	}
+
+	db.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", key.ID)
+	c.Set("api_key", key)
+	return true
+}
+
+// trustedProxies are the proxies whose X-Forwarded-For is believed, from
+// TRUSTED_PROXIES
+var trustedProxies []string
+
+// clientIP is the address a request is rate limited and recorded by: the
+// connection's peer unless it is a trusted proxy
+func clientIP(c *gin.Context) string {
+	if len(trustedProxies) == 0 {
+		return c.RemoteIP()
+	}
+	return c.ClientIP()
+}
+
+// ipRateLimiter limits requests per client IP for endpoints open to
+// anonymous clients
+type ipRateLimiter struct {
+	every time.Duration
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// Clients whose allowance has refilled are forgotten once this many IPs
+// are tracked
+const maxTrackedIPs = 4096
+
+// newIPRateLimiter allows burst requests per IP, refilling one every interval
+func newIPRateLimiter(every time.Duration, burst int) *ipRateLimiter {
+	return &ipRateLimiter{every: every, burst: burst, limiters: make(map[string]*rate.Limiter)}
+}
+
+// limit is a middleware answering 429 to clients over their allowance
+func (l *ipRateLimiter) limit(c *gin.Context) {
+	l.mu.Lock()
+	if len(l.limiters) >= maxTrackedIPs {
+		for ip, limiter := range l.limiters {
+			if limiter.Tokens() >= float64(l.burst) {
+				delete(l.limiters, ip)
+			}
+		}
+	}
+	ip := clientIP(c)
+	limiter, ok := l.limiters[ip]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Every(l.every), l.burst)
+		l.limiters[ip] = limiter
+	}
+	reservation := limiter.Reserve()
+	l.mu.Unlock()
+
+	if wait := reservation.Delay(); wait > 0 {
+		reservation.Cancel()
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, try again later"})
+		return
+	}
+	c.Next()
+}
+
+// currentAPIKey returns the key authenticated by requireRole, if any
+func currentAPIKey(c *gin.Context) *APIKey {
+	if v, ok := c.Get("api_key"); ok {
+		return v.(*APIKey)
+	}
+	return nil
+}
+
+// ==================== Key Management Handlers ====================
+
+func listAPIKeysHandler(c *gin.Context) {
+	keys, err := listAPIKeys()
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func createAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	key, secret, err := createAPIKey(req.Name, req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The plaintext key is only ever returned here
+	c.JSON(http.StatusCreated, gin.H{"key": secret, "api_key": key})
+}
+
+func revokeAPIKeyHandler(c *gin.Context) {
+	id := c.Param("id")
+	revoked, err := revokeAPIKey(id)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id})
+}
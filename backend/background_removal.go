@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Background removal tolerances, as the RGB distance (0-441) a pixel may
+// differ from the background colour and still be treated as background
+const (
+	defaultBackgroundTolerance = 32
+	maxBackgroundTolerance     = 128
+)
+
+// Share of the opaque edge pixels that must match the background colour for
+// the background to count as uniform
+const backgroundEdgeCoverage = 0.7
+
+// detectBackgroundColor looks for a uniform colour along the image edges.
+// ok is false when the edges are mostly transparent already or do not share
+// one colour within tolerance.
+func detectBackgroundColor(img *image.NRGBA, tolerance float64) (bg color.NRGBA, ok bool) {
+	b := img.Bounds()
+	var edge []color.NRGBA
+	transparent := 0
+	add := func(x, y int) {
+		c := img.NRGBAAt(x, y)
+		if c.A < 128 {
+			transparent++
+			return
+		}
+		edge = append(edge, c)
+	}
+	for x := b.Min.X; x < b.Max.X; x++ {
+		add(x, b.Min.Y)
+		if b.Dy() > 1 {
+			add(x, b.Max.Y-1)
+		}
+	}
+	for y := b.Min.Y + 1; y < b.Max.Y-1; y++ {
+		add(b.Min.X, y)
+		if b.Dx() > 1 {
+			add(b.Max.X-1, y)
+		}
+	}
+	if len(edge) == 0 || transparent > len(edge) {
+		return bg, false
+	}
+
+	// The per-channel median is robust against the crest touching an edge
+	median := func(channel func(color.NRGBA) uint8) uint8 {
+		values := make([]int, len(edge))
+		for i, c := range edge {
+			values[i] = int(channel(c))
+		}
+		sort.Ints(values)
+		return uint8(values[len(values)/2])
+	}
+	bg = color.NRGBA{
+		R: median(func(c color.NRGBA) uint8 { return c.R }),
+		G: median(func(c color.NRGBA) uint8 { return c.G }),
+		B: median(func(c color.NRGBA) uint8 { return c.B }),
+		A: 255,
+	}
+
+	matching := 0
+	for _, c := range edge {
+		if colorDistance(c, bg) <= tolerance {
+			matching++
+		}
+	}
+	return bg, float64(matching) >= backgroundEdgeCoverage*float64(len(edge))
+}
+
+// colorDistance is the Euclidean distance of two colours in RGB space
+func colorDistance(a, b color.NRGBA) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+// RemoveBackground makes a uniform background transparent. The background is
+// flood-filled from the image edges, so enclosed areas of the same colour
+// (e.g. white inside a crest) are kept. Pixels along the fill boundary that
+// blend into the background get partial alpha and the background colour is
+// taken out of them, so anti-aliased edges do not keep a halo. Returns false
+// when no uniform background was found.
+func RemoveBackground(src image.Image, tolerance int) (*image.NRGBA, color.NRGBA, bool) {
+	if tolerance <= 0 {
+		tolerance = defaultBackgroundTolerance
+	}
+	tol := float64(tolerance)
+
+	b := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	bg, ok := detectBackgroundColor(img, tol)
+	if !ok {
+		return img, bg, false
+	}
+
+	isBackground := func(i int) bool {
+		c := color.NRGBA{img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], img.Pix[i*4+3]}
+		return c.A >= 128 && colorDistance(c, bg) <= tol
+	}
+
+	// Flood fill from every matching edge pixel
+	filled := make([]bool, w*h)
+	queue := make([]int, 0, 2*(w+h))
+	seed := func(x, y int) {
+		i := y*w + x
+		if !filled[i] && isBackground(i) {
+			filled[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for x := 0; x < w; x++ {
+		seed(x, 0)
+		seed(x, h-1)
+	}
+	for y := 0; y < h; y++ {
+		seed(0, y)
+		seed(w-1, y)
+	}
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		x, y := i%w, i/w
+		if x > 0 {
+			seed(x-1, y)
+		}
+		if x < w-1 {
+			seed(x+1, y)
+		}
+		if y > 0 {
+			seed(x, y-1)
+		}
+		if y < h-1 {
+			seed(x, y+1)
+		}
+	}
+
+	// Soften the pixels bordering the filled area. Each is treated as a blend
+	// of the background and the strongest foreground colour next to it.
+	distance := func(i int) float64 {
+		return colorDistance(color.NRGBA{img.Pix[i*4], img.Pix[i*4+1], img.Pix[i*4+2], 255}, bg)
+	}
+	var soft []int
+	var alphas []float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			if filled[i] || !touchesFilled(filled, w, h, x, y) {
+				continue
+			}
+			d, ref := distance(i), 0.0
+			for ny := max(y-1, 0); ny <= min(y+1, h-1); ny++ {
+				for nx := max(x-1, 0); nx <= min(x+1, w-1); nx++ {
+					if j := ny*w + nx; !filled[j] {
+						ref = math.Max(ref, distance(j))
+					}
+				}
+			}
+			// Also look one pixel further for wider anti-aliasing
+			for _, n := range [][2]int{{x - 2, y}, {x + 2, y}, {x, y - 2}, {x, y + 2}} {
+				if n[0] >= 0 && n[1] >= 0 && n[0] < w && n[1] < h && !filled[n[1]*w+n[0]] {
+					ref = math.Max(ref, distance(n[1]*w+n[0]))
+				}
+			}
+			if ref <= tol || d >= 0.95*ref {
+				continue
+			}
+			soft = append(soft, i)
+			alphas = append(alphas, math.Max(0.05, (d-tol)/(ref-tol)))
+		}
+	}
+	for k, i := range soft {
+		alpha := alphas[k]
+		p := img.Pix[i*4 : i*4+4]
+		// Undo the blend: c = alpha*fg + (1-alpha)*bg
+		unblend := func(v, bgv uint8) uint8 {
+			f := (float64(v) - (1-alpha)*float64(bgv)) / alpha
+			return uint8(math.Max(0, math.Min(255, math.Round(f))))
+		}
+		p[0], p[1], p[2] = unblend(p[0], bg.R), unblend(p[1], bg.G), unblend(p[2], bg.B)
+		p[3] = uint8(math.Round(float64(p[3]) * alpha))
+	}
+
+	for i, isFilled := range filled {
+		if isFilled {
+			copy(img.Pix[i*4:i*4+4], []uint8{0, 0, 0, 0})
+		}
+	}
+	return img, bg, true
+}
+
+// touchesFilled reports whether any of the 8 neighbours of (x, y) is filled
+func touchesFilled(filled []bool, w, h, x, y int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			if (dx != 0 || dy != 0) && nx >= 0 && ny >= 0 && nx < w && ny < h && filled[ny*w+nx] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeBackgroundFile removes a uniform background from a PNG file in
+// place. The file is left unchanged when no background was found.
+func removeBackgroundFile(pngPath string, tolerance int) (bool, error) {
+	f, err := os.Open(pngPath)
+	if err != nil {
+		return false, err
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		return false, err
+	}
+
+	out, _, removed := RemoveBackground(img, tolerance)
+	if !removed {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(pngPath, buf.Bytes(), 0644)
+}
+
+// parseBackgroundTolerance reads the background_tolerance form field
+func parseBackgroundTolerance(v string) (int, error) {
+	if v == "" {
+		return defaultBackgroundTolerance, nil
+	}
+	tolerance, err := strconv.Atoi(v)
+	if err != nil || tolerance < 1 || tolerance > maxBackgroundTolerance {
+		return 0, fmt.Errorf("background_tolerance must be between 1 and %d", maxBackgroundTolerance)
+	}
+	return tolerance, nil
+}
+
+// ==================== Background Handlers ====================
+
+// previewBackgroundRemoval returns an uploaded raster image as PNG with its
+// background removed, without storing anything, so the result can be checked
+// before uploading with remove_background=true
+func previewBackgroundRemoval(c *gin.Context) {
+	tolerance, err := parseBackgroundTolerance(c.PostForm("background_tolerance"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return
+	}
+
+	format := DetectImageFormat(data)
+	if _, ok := rasterSourceFormats[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "background removal needs a PNG, JPEG, WebP or GIF image"})
+		return
+	}
+	if err := checkRasterImage(data, format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	out, bg, removed := RemoveBackground(img, tolerance)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode preview"})
+		return
+	}
+
+	c.Header("X-Background-Removed", strconv.FormatBool(removed))
+	if removed {
+		c.Header("X-Background-Color", fmt.Sprintf("#%02x%02x%02x", bg.R, bg.G, bg.B))
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
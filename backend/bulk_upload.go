@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Limits of POST /logos/bulk
+const (
+	maxBulkUploadSize = 200 << 20 // 200 MB
+	maxBulkEntries    = 1000
+	maxBulkEntrySize  = 10 << 20 // 10 MB
+)
+
+// BulkRejected is the status of a ZIP entry that was not queued
+const BulkRejected = "rejected"
+
+// bulkEntryName matches logo files in a bulk ZIP, e.g. "<uuid>.svg"
+var bulkEntryName = regexp.MustCompile(`(?i)^([0-9a-f-]{36})\.(svg|png|pdf|jpe?g|webp|gif)$`)
+
+// BulkFile is the outcome of one ZIP entry. Status is the status of its
+// upload job, or BulkRejected when the entry could not be queued.
+type BulkFile struct {
+	File     string   `json:"file"`
+	ID       string   `json:"id,omitempty"`
+	JobID    string   `json:"job_id,omitempty"`
+	Status   string   `json:"status"`
+	Revision int      `json:"revision,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// BulkUpload reports on a ZIP upload. Status is "processing" while any of
+// its jobs is queued or running, "done" afterwards.
+type BulkUpload struct {
+	ID         string         `json:"id"`
+	Status     string         `json:"status"`
+	Counts     map[string]int `json:"counts"`
+	Files      []BulkFile     `json:"files"`
+	Warnings   []string       `json:"warnings,omitempty"`
+	UploadedBy string         `json:"uploaded_by,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// bulkManifestEntry is the club metadata of one manifest row
+type bulkManifestEntry struct {
+	ID          string  `json:"id"`
+	ClubName    string  `json:"club_name"`
+	ClubCity    string  `json:"club_city"`
+	ClubType    string  `json:"club_type"`
+	ClubWebsite string  `json:"club_website"`
+	ClubAliases *string `json:"club_aliases"`
+}
+
+// parseBulkManifest reads manifest.csv (with a header row) or manifest.json
+// (an array of objects, or an object keyed by club ID) into entries by ID
+func parseBulkManifest(name string, data []byte) (map[string]bulkManifestEntry, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	var entries []bulkManifestEntry
+
+	if strings.HasSuffix(strings.ToLower(name), ".json") {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			var byID map[string]bulkManifestEntry
+			if err := json.Unmarshal(data, &byID); err != nil {
+				return nil, fmt.Errorf("invalid %s: expected an array or an object keyed by club ID", name)
+			}
+			for id, entry := range byID {
+				entry.ID = id
+				entries = append(entries, entry)
+			}
+		}
+	} else {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		// Columns are matched by header name, short forms are accepted
+		columns := map[string]int{}
+		for i, h := range rows[0] {
+			h = strings.ToLower(strings.TrimSpace(h))
+			switch h {
+			case "uuid":
+				h = "id"
+			case "name", "city", "type", "website", "aliases":
+				h = "club_" + h
+			}
+			columns[h] = i
+		}
+		if _, ok := columns["id"]; !ok {
+			return nil, fmt.Errorf("invalid %s: missing id column", name)
+		}
+		field := func(row []string, column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		for _, row := range rows[1:] {
+			entry := bulkManifestEntry{
+				ID:          field(row, "id"),
+				ClubName:    field(row, "club_name"),
+				ClubCity:    field(row, "club_city"),
+				ClubType:    field(row, "club_type"),
+				ClubWebsite: field(row, "club_website"),
+			}
+			if i, ok := columns["club_aliases"]; ok && i < len(row) {
+				aliases := row[i]
+				entry.ClubAliases = &aliases
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	manifest := map[string]bulkManifestEntry{}
+	for _, entry := range entries {
+		id, err := uuid.Parse(strings.TrimSpace(entry.ID))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q is not a club UUID", name, entry.ID)
+		}
+		manifest[id.String()] = entry
+	}
+	return manifest, nil
+}
+
+// isBulkMetadataFile reports ZIP entries that are neither logos nor the
+// manifest and are skipped silently (folders, macOS resource forks)
+func isBulkMetadataFile(f *zip.File) bool {
+	return f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".")
+}
+
+// queueBulkEntry validates one ZIP entry and queues its upload job
+func queueBulkEntry(c *gin.Context, f *zip.File, options logoUploadForm, manifest map[string]bulkManifestEntry, seen map[string]bool) BulkFile {
+	file := BulkFile{File: f.Name, Status: BulkRejected}
+	m := bulkEntryName.FindStringSubmatch(path.Base(f.Name))
+	if m == nil {
+		file.Error = "file name must be <club uuid>.svg, .png, .pdf, .jpg, .webp or .gif"
+		return file
+	}
+	id, err := uuid.Parse(m[1])
+	if err != nil {
+		file.Error = "invalid club UUID in file name"
+		return file
+	}
+	file.ID = id.String()
+	if seen[file.ID] {
+		file.Error = "another file in the ZIP is for the same club"
+		return file
+	}
+	seen[file.ID] = true
+
+	if f.UncompressedSize64 > maxBulkEntrySize {
+		file.Error = fmt.Sprintf("file is larger than %d MB", maxBulkEntrySize>>20)
+		return file
+	}
+	rc, err := f.Open()
+	if err != nil {
+		file.Error = "cannot read file: " + err.Error()
+		return file
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, maxBulkEntrySize+1))
+	rc.Close()
+	if err != nil || len(data) > maxBulkEntrySize {
+		file.Error = "cannot read file"
+		return file
+	}
+
+	// The type comes from the content, as for single uploads
+	ext, ok := uploadExtensions[DetectImageFormat(data)]
+	if !ok {
+		file.Error = "unsupported file type, expected SVG, PNG, PDF, JPEG, WebP or GIF"
+		return file
+	}
+
+	form := options
+	form.LogoID, form.Ext = file.ID, ext
+	payload := logoJobPayload{Form: form}
+	if entry, ok := manifest[file.ID]; ok {
+		payload.Form.ClubName = entry.ClubName
+		payload.Form.ClubCity = entry.ClubCity
+		payload.Form.ClubType = entry.ClubType
+		payload.Form.ClubWebsite = entry.ClubWebsite
+		payload.Aliases = entry.ClubAliases
+	}
+	if key := currentAPIKey(c); key != nil {
+		payload.UploadedBy = key.Name
+		payload.APIKeyID = key.ID
+	}
+
+	jobID := uuid.NewString()
+	payload.InputKey = jobInputKey(jobID, "upload"+ext)
+	if err := store.Put(c.Request.Context(), payload.InputKey, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		log.Printf("Failed to store bulk entry %s: %v", f.Name, err)
+		file.Error = "failed to save upload"
+		return file
+	}
+	job, err := enqueueJob(jobID, JobKindLogoUpload, file.ID, &payload)
+	if err != nil {
+		store.Delete(c.Request.Context(), payload.InputKey)
+		log.Printf("Failed to queue bulk entry %s: %v", f.Name, err)
+		file.Error = "failed to queue upload"
+		return file
+	}
+	file.JobID, file.Status = job.ID, job.Status
+	return file
+}
+
+// loadBulkUpload loads a bulk upload and fills in the current state of its
+// jobs
+func loadBulkUpload(id string) (*BulkUpload, error) {
+	bulk := BulkUpload{ID: id}
+	var files string
+	var warnings, uploadedBy sql.NullString
+	if err := db.QueryRow("SELECT files, warnings, uploaded_by, created_at FROM bulk_uploads WHERE id = ?", id).
+		Scan(&files, &warnings, &uploadedBy, &bulk.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(files), &bulk.Files); err != nil {
+		return nil, err
+	}
+	if warnings.Valid {
+		json.Unmarshal([]byte(warnings.String), &bulk.Warnings)
+	}
+	bulk.UploadedBy = uploadedBy.String
+
+	bulk.Status = "done"
+	bulk.Counts = map[string]int{}
+	for i := range bulk.Files {
+		file := &bulk.Files[i]
+		if file.JobID != "" {
+			job, err := loadJob(file.JobID)
+			if err != nil {
+				return nil, err
+			}
+			file.Status, file.Error = job.Status, job.Error
+			if job.Status == JobSucceeded {
+				var result struct {
+					Revision int      `json:"revision"`
+					Warnings []string `json:"warnings"`
+				}
+				json.Unmarshal(job.Result, &result)
+				file.Revision, file.Warnings = result.Revision, result.Warnings
+			}
+			if job.Status == JobQueued || job.Status == JobRunning {
+				bulk.Status = "processing"
+			}
+		}
+		bulk.Counts[file.Status]++
+	}
+	return &bulk, nil
+}
+
+// ==================== Bulk Upload Handlers ====================
+
+// uploadLogoBulk queues every logo of a ZIP through the regular upload
+// pipeline. Club metadata comes from an optional manifest.csv or
+// manifest.json; clubs missing from it are looked up on FAČR.
+func uploadLogoBulk(c *gin.Context) {
+	var options logoUploadForm
+	if err := options.readOptions(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	upload, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+	if upload.Size > maxBulkUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("ZIP is larger than %d MB", maxBulkUploadSize>>20)})
+		return
+	}
+	f, err := upload.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return
+	}
+	defer f.Close()
+	archive, err := zip.NewReader(f, upload.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ZIP file"})
+		return
+	}
+
+	// Split the manifest from the logo files
+	var manifestFile *zip.File
+	var entries []*zip.File
+	for _, entry := range archive.File {
+		if isBulkMetadataFile(entry) {
+			continue
+		}
+		switch strings.ToLower(path.Base(entry.Name)) {
+		case "manifest.csv", "manifest.json":
+			if manifestFile != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "the ZIP contains more than one manifest"})
+				return
+			}
+			manifestFile = entry
+		default:
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the ZIP contains no logo files"})
+		return
+	}
+	if len(entries) > maxBulkEntries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the ZIP contains more than %d files", maxBulkEntries)})
+		return
+	}
+
+	manifest := map[string]bulkManifestEntry{}
+	if manifestFile != nil {
+		rc, err := manifestFile.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot read the manifest"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(rc, maxBulkEntrySize))
+		rc.Close()
+		if err == nil {
+			manifest, err = parseBulkManifest(path.Base(manifestFile.Name), data)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	bulk := BulkUpload{ID: uuid.NewString(), Files: []BulkFile{}}
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		bulk.Files = append(bulk.Files, queueBulkEntry(c, entry, options, manifest, seen))
+	}
+	for id := range manifest {
+		if !seen[id] {
+			bulk.Warnings = append(bulk.Warnings, fmt.Sprintf("the manifest lists %s but the ZIP has no file for it", id))
+		}
+	}
+
+	var apiKeyID string
+	if key := currentAPIKey(c); key != nil {
+		bulk.UploadedBy, apiKeyID = key.Name, key.ID
+	}
+	files, _ := json.Marshal(bulk.Files)
+	var warnings sql.NullString
+	if len(bulk.Warnings) > 0 {
+		data, _ := json.Marshal(bulk.Warnings)
+		warnings = sql.NullString{String: string(data), Valid: true}
+	}
+	if _, err := db.Exec(`
+		INSERT INTO bulk_uploads (id, files, warnings, uploaded_by, api_key_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, bulk.ID, string(files), warnings, nullString(bulk.UploadedBy), nullString(apiKeyID)); err != nil {
+		log.Printf("Failed to record bulk upload: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	report, err := loadBulkUpload(bulk.ID)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":    true,
+		"bulk":       report,
+		"status_url": requestBaseURL(c) + "/logos/bulk/" + bulk.ID,
+		"message":    fmt.Sprintf("%d of %d files queued for processing", len(bulk.Files)-report.Counts[BulkRejected], len(bulk.Files)),
+	})
+}
+
+// getBulkUpload returns the per-file report of a bulk upload
+func getBulkUpload(c *gin.Context) {
+	id := c.Param("batch")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid bulk upload ID"})
+		return
+	}
+
+	bulk, err := loadBulkUpload(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "bulk upload not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, bulk)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// runCLI executes an administrative subcommand (e.g. "keys create") and
+// returns the process exit code
+func runCLI(args []string) int {
+	switch args[0] {
+	case "keys":
+		return runKeysCommand(args[1:])
+	case "clubs":
+		return runClubsCommand(args[1:])
+	case "coverage":
+		return runCoverageCommand(args[1:])
+	case "mock-upstream":
+		return runMockUpstreamCommand(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nUsage:\n  server                 start the API server\n  server keys <command>  manage API keys (create, list, revoke)\n  server clubs sync      sync the local club directory\n  server coverage        report clubs without logos\n  server mock-upstream   serve sample clubs as a fake FAČR API and fotbal.cz\n", args[0])
+		return 2
+	}
+}
+
+func runKeysCommand(args []string) int {
+	usage := "Usage:\n  server keys create -name NAME -role reader|contributor|admin\n  server keys list\n  server keys revoke ID\n"
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := fs.String("name", "", "descriptive name of the key owner")
+		role := fs.String("role", RoleContributor, "reader, contributor or admin")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		key, secret, err := createAPIKey(*name, *role)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		fmt.Printf("Created %s key %q (id %s)\n", key.Role, key.Name, key.ID)
+		fmt.Printf("Key: %s\n", secret)
+		fmt.Println("Store it now, it cannot be shown again.")
+		return 0
+
+	case "list":
+		keys, err := listAPIKeys()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tROLE\tPREFIX\tCREATED\tSTATUS")
+		for _, key := range keys {
+			status := "active"
+			if key.RevokedAt != nil {
+				status = "revoked"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Role, key.Prefix, key.CreatedAt.Format("2006-01-02"), status)
+		}
+		w.Flush()
+		return 0
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		revoked, err := revokeAPIKey(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if !revoked {
+			fmt.Fprintln(os.Stderr, "No active key with that ID")
+			return 1
+		}
+		fmt.Println("Key revoked")
+		return 0
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runClubsCommand(args []string) int {
+	usage := "Usage:\n  server clubs sync [-limit N] [-all] [-delay 1s]\n"
+	if len(args) == 0 || args[0] != "sync" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("clubs sync", flag.ContinueOnError)
+	limit := fs.Int("limit", defaultClubSyncBatch, "queries per batch")
+	all := fs.Bool("all", false, "repeat batches until no query is pending")
+	delay := fs.Duration("delay", clubSyncDelay, "pause between upstream searches")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	client, err := newUpstreamClientFromEnv()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	source, err := newClubSourceFromEnv(client)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	for {
+		result, err := syncClubDirectory(context.Background(), source, *limit, *delay)
+		fmt.Printf("%d queries (%d failed): %d clubs found, %d added, %d updated; %d in the directory, %d queries pending\n",
+			result.Queries, result.Failed, result.Found, result.Added, result.Updated, result.Clubs, result.Pending)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		if !*all || result.Pending == 0 {
+			return 0
+		}
+	}
+}
+
+func runCoverageCommand(args []string) int {
+	fs := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	clubType := fs.String("type", "", "football or futsal")
+	city := fs.String("city", "", "only clubs in this city")
+	region := fs.String("region", "", "only clubs in this postal region (1-7)")
+	minSize := fs.Int("min-size", defaultCoverageMinSize, "smallest acceptable PNG crest, in pixels")
+	list := fs.String("list", "", "print the clubs of one list: missing, missing_svg, low_resolution or unknown_resolution")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	filter, err := parseCoverageFilter(*clubType, *city, *region, strconv.Itoa(*minSize))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+
+	report, err := buildCoverageReport(filter, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if report.Warning != "" {
+		fmt.Fprintln(os.Stderr, "Warning:", report.Warning)
+	}
+
+	lists := map[string][]CoverageClub{
+		"missing":            report.Missing,
+		"missing_svg":        report.MissingSVG,
+		"low_resolution":     report.LowResolution,
+		"unknown_resolution": report.UnknownResolution,
+	}
+	if *list != "" {
+		clubs, ok := lists[*list]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown list %q, expected missing, missing_svg, low_resolution or unknown_resolution\n", *list)
+			return 2
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tCITY\tREGION\tPNG SIZE")
+		for _, club := range clubs {
+			size := ""
+			if club.PNGSize > 0 {
+				size = strconv.Itoa(club.PNGSize)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", club.ID, club.Name, club.Type, club.City, club.Region, size)
+		}
+		w.Flush()
+		return 0
+	}
+
+	fmt.Printf("Clubs:          %d\n", report.Clubs)
+	fmt.Printf("With logo:      %d (%.1f%%)\n", report.WithLogo, report.Coverage*100)
+	fmt.Printf("Missing logo:   %d\n", report.Counts["missing"])
+	fmt.Printf("Missing SVG:    %d\n", report.Counts["missing_svg"])
+	fmt.Printf("Low resolution: %d (PNG only, under %d px)\n", report.Counts["low_resolution"], filter.MinSize)
+	fmt.Printf("Unknown size:   %d (PNG only, crest not measured)\n", report.Counts["unknown_resolution"])
+	fmt.Printf("Logos of clubs outside the directory: %d\n", report.Unlisted)
+	return 0
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// Club cache lifetimes. Entries younger than CLUB_CACHE_TTL are served as
+// they are. Older ones are still served, and refreshed in the background,
+// for another CLUB_CACHE_STALE; after that lookups wait for upstream again.
+// Unknown clubs and empty searches are kept for at most clubCacheMissTTL.
+const (
+	defaultClubCacheTTL   = 24 * time.Hour
+	defaultClubCacheStale = 7 * 24 * time.Hour
+	clubCacheMissTTL      = time.Hour
+)
+
+// CacheStatus tells how a cached lookup was answered, sent as X-Cache
+type CacheStatus string
+
+const (
+	CacheHit   CacheStatus = "HIT"   // fresh cache entry
+	CacheStale CacheStatus = "STALE" // expired entry, being refreshed or upstream failed
+	CacheMiss  CacheStatus = "MISS"  // fetched from upstream
+)
+
+// CacheInfo describes the cache entry that answered a lookup
+type CacheInfo struct {
+	Status    CacheStatus
+	FetchedAt time.Time
+}
+
+// setHeaders reports the cache status and the age of the answer
+func (info CacheInfo) setHeaders(c *gin.Context) {
+	c.Header("X-Cache", string(info.Status))
+	if !info.FetchedAt.IsZero() {
+		c.Header("Age", strconv.Itoa(max(0, int(time.Since(info.FetchedAt).Seconds()))))
+	}
+}
+
+// clubCacheEntry is a cached upstream answer. Miss marks an unknown club
+// (Data is nil) or a search without results.
+type clubCacheEntry struct {
+	Data      []byte
+	Miss      bool
+	FetchedAt time.Time
+}
+
+// ClubCache keeps club records and search results from a ClubSource in
+// SQLite. Concurrent lookups of the same key share one upstream request.
+type ClubCache struct {
+	source ClubSource
+	ttl    time.Duration
+	stale  time.Duration
+	group  singleflight.Group
+}
+
+// clubCache serves club search and lookups from clubSource
+var clubCache *ClubCache
+
+// envDuration reads a duration such as "12h" from the environment
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a duration such as 12h", name, v)
+	}
+	return d, nil
+}
+
+// newClubCacheFromEnv wraps source with the cache configured by
+// CLUB_CACHE_TTL and CLUB_CACHE_STALE, and drops entries too old to serve
+func newClubCacheFromEnv(source ClubSource) (*ClubCache, error) {
+	cache := &ClubCache{source: source}
+	var err error
+	if cache.ttl, err = envDuration("CLUB_CACHE_TTL", defaultClubCacheTTL); err != nil {
+		return nil, err
+	}
+	if cache.stale, err = envDuration("CLUB_CACHE_STALE", defaultClubCacheStale); err != nil {
+		return nil, err
+	}
+
+	res, err := db.Exec("DELETE FROM club_cache WHERE fetched_at < ?", time.Now().UTC().Add(-cache.ttl-cache.stale))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("✓ Dropped %d expired club cache entries", n)
+	}
+	return cache, nil
+}
+
+func (cache *ClubCache) load(key string) (*clubCacheEntry, error) {
+	var entry clubCacheEntry
+	var data sql.NullString
+	err := db.QueryRow("SELECT data, miss, fetched_at FROM club_cache WHERE key = ?", key).
+		Scan(&data, &entry.Miss, &entry.FetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data.Valid {
+		entry.Data = []byte(data.String)
+	}
+	return &entry, nil
+}
+
+// fetch asks upstream and stores the answer; upstream errors are not cached
+func (cache *ClubCache) fetch(ctx context.Context, key string, fetch func(context.Context) (clubCacheEntry, error)) (clubCacheEntry, error) {
+	entry, err := fetch(ctx)
+	if err != nil {
+		return entry, err
+	}
+	entry.FetchedAt = time.Now().UTC()
+	var data interface{}
+	if entry.Data != nil {
+		data = string(entry.Data)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO club_cache (key, data, miss, fetched_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET data = excluded.data, miss = excluded.miss, fetched_at = excluded.fetched_at
+	`, key, data, entry.Miss, entry.FetchedAt); err != nil {
+		log.Printf("Failed to cache %s: %v", key, err)
+	}
+	return entry, nil
+}
+
+// lookup answers key from the cache, calling fetch when the entry is
+// missing or expired. The upstream request is shared by every caller
+// waiting for key, so it outlives the caller's ctx and fills the cache
+// even when that caller gives up.
+func (cache *ClubCache) lookup(ctx context.Context, key string, fetch func(context.Context) (clubCacheEntry, error)) (clubCacheEntry, CacheInfo, error) {
+	shared := context.WithoutCancel(ctx)
+	cached, err := cache.load(key)
+	if err != nil {
+		log.Printf("Failed to read club cache: %v", err)
+	}
+	if cached != nil {
+		ttl := cache.ttl
+		if cached.Miss {
+			ttl = min(ttl, clubCacheMissTTL)
+		}
+		age := time.Since(cached.FetchedAt)
+		if age < ttl {
+			return *cached, CacheInfo{CacheHit, cached.FetchedAt}, nil
+		}
+		if age < ttl+cache.stale {
+			// Revalidate in the background, once per key
+			cache.group.DoChan(key, func() (interface{}, error) {
+				return cache.fetch(shared, key, fetch)
+			})
+			return *cached, CacheInfo{CacheStale, cached.FetchedAt}, nil
+		}
+	}
+
+	var v interface{}
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case res := <-cache.group.DoChan(key, func() (interface{}, error) {
+		return cache.fetch(shared, key, fetch)
+	}):
+		v, err = res.Val, res.Err
+	}
+	if err != nil {
+		// An old answer beats none while upstream is down
+		if cached != nil {
+			return *cached, CacheInfo{CacheStale, cached.FetchedAt}, nil
+		}
+		return clubCacheEntry{}, CacheInfo{Status: CacheMiss}, err
+	}
+	entry := v.(clubCacheEntry)
+	return entry, CacheInfo{CacheMiss, entry.FetchedAt}, nil
+}
+
+// Lookup returns a club by ID; the error is ErrClubNotFound for unknown clubs
+func (cache *ClubCache) Lookup(ctx context.Context, id string) (*Club, CacheInfo, error) {
+	entry, info, err := cache.lookup(ctx, "club:"+id, func(ctx context.Context) (clubCacheEntry, error) {
+		club, err := cache.source.GetClub(ctx, id)
+		if errors.Is(err, ErrClubNotFound) {
+			return clubCacheEntry{Miss: true}, nil
+		}
+		if err != nil {
+			return clubCacheEntry{}, err
+		}
+		data, err := json.Marshal(club)
+		return clubCacheEntry{Data: data}, err
+	})
+	if err != nil {
+		return nil, info, err
+	}
+	if entry.Data == nil {
+		return nil, info, ErrClubNotFound
+	}
+	var club Club
+	if err := json.Unmarshal(entry.Data, &club); err != nil {
+		return nil, info, err
+	}
+	return &club, info, nil
+}
+
+// Search returns the clubs matching a query; queries differing only in case
+// and surrounding spaces share an entry
+func (cache *ClubCache) Search(ctx context.Context, query string) ([]Club, CacheInfo, error) {
+	key := "search:" + strings.ToLower(strings.TrimSpace(query))
+	entry, info, err := cache.lookup(ctx, key, func(ctx context.Context) (clubCacheEntry, error) {
+		clubs, err := cache.source.SearchClubs(ctx, query)
+		if err != nil {
+			return clubCacheEntry{}, err
+		}
+		data, err := json.Marshal(clubs)
+		return clubCacheEntry{Data: data, Miss: len(clubs) == 0}, err
+	})
+	if err != nil {
+		return nil, info, err
+	}
+	clubs := []Club{}
+	if err := json.Unmarshal(entry.Data, &clubs); err != nil {
+		return nil, info, err
+	}
+	return clubs, info, nil
+}
+
+// The cache is a ClubSource itself
+
+func (cache *ClubCache) Name() string {
+	return "cache(" + cache.source.Name() + ")"
+}
+
+func (cache *ClubCache) SearchClubs(ctx context.Context, query string) ([]Club, error) {
+	clubs, _, err := cache.Search(ctx, query)
+	return clubs, err
+}
+
+func (cache *ClubCache) GetClub(ctx context.Context, id string) (*Club, error) {
+	club, _, err := cache.Lookup(ctx, id)
+	return club, err
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// The club directory is a local copy of the FAČR club list. A sync run
+// searches upstream for the queries synced longest ago; queries start from
+// clubDirectorySeeds and grow with every city a club is found in, so the
+// crawl widens as it goes.
+const (
+	defaultClubSyncBatch    = 50
+	maxClubSyncBatch        = 1000
+	defaultClubSyncInterval = 6 * time.Hour
+	clubSyncDelay           = time.Second
+	maxClubDirectoryResults = 50
+)
+
+// clubSyncJobKey is the lock key of sync jobs, so only one sync runs at a
+// time
+const clubSyncJobKey = "club-directory"
+
+// clubDirectorySeeds are the first sync queries: words most club names start with
+var clubDirectorySeeds = []string{
+	"FC", "FK", "SK", "TJ", "AFK", "MFK", "SFC", "SFK", "1. FC", "1. FK", "Sokol",
+	"Baník", "Dynamo", "Jiskra", "Lokomotiva", "Slavia", "Slavoj", "Slovan",
+	"Sparta", "Spartak", "Start", "Tatran", "Union", "Viktoria", "Futsal",
+}
+
+// ClubSyncResult summarizes a sync run
+type ClubSyncResult struct {
+	Queries int `json:"queries"`
+	Failed  int `json:"failed"`
+	Found   int `json:"found"`
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Pending int `json:"pending"`
+	Clubs   int `json:"clubs"`
+}
+
+type clubSyncPayload struct {
+	Limit int `json:"limit"`
+}
+
+// saveDirectoryClubs adds or refreshes clubs in the directory and queues
+// their cities as sync queries
+func saveDirectoryClubs(clubs []Club) (added, updated int, err error) {
+	now := time.Now().UTC()
+	for _, club := range clubs {
+		if _, err := uuid.Parse(club.ID); err != nil || club.Name == "" {
+			continue
+		}
+		var exists bool
+		if err := db.QueryRow("SELECT COUNT(*) > 0 FROM clubs WHERE id = ?", club.ID).Scan(&exists); err != nil {
+			return added, updated, err
+		}
+		// Lookups may know less than the search did, keep what is known
+		if _, err := db.Exec(`
+			INSERT INTO clubs (id, name, type, address, city, logo_url, search_text, synced_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				name = excluded.name,
+				type = COALESCE(excluded.type, clubs.type),
+				address = COALESCE(excluded.address, clubs.address),
+				city = COALESCE(excluded.city, clubs.city),
+				logo_url = COALESCE(excluded.logo_url, clubs.logo_url),
+				search_text = excluded.search_text,
+				synced_at = excluded.synced_at
+		`, club.ID, club.Name, nullString(club.Type), nullString(club.Address), nullString(club.City),
+			nullString(club.LogoURL), normalizeSearchText(club.Name+" "+club.City), now); err != nil {
+			return added, updated, err
+		}
+		if exists {
+			updated++
+		} else {
+			added++
+		}
+		if club.City != "" {
+			db.Exec("INSERT OR IGNORE INTO club_sync_queries (query) VALUES (?)", club.City)
+		}
+	}
+	return added, updated, nil
+}
+
+func scanDirectoryClub(row interface{ Scan(...interface{}) error }) (Club, error) {
+	var club Club
+	var typ, address, city, logoURL sql.NullString
+	err := row.Scan(&club.ID, &club.Name, &typ, &address, &city, &logoURL)
+	club.Type, club.Address, club.City, club.LogoURL = typ.String, address.String, city.String, logoURL.String
+	return club, err
+}
+
+// lookupDirectoryClub returns a club from the directory, ErrClubNotFound
+// when it is not there
+func lookupDirectoryClub(id string) (*Club, error) {
+	club, err := scanDirectoryClub(db.QueryRow("SELECT id, name, type, address, city, logo_url FROM clubs WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrClubNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &club, nil
+}
+
+// escapeLike escapes the LIKE wildcards of s for ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// clubDirectoryComplete tells whether the sync has run every query at least
+// once, so a directory search no longer misses clubs the sources know
+func clubDirectoryComplete() bool {
+	var queries, pending int
+	err := db.QueryRow("SELECT COUNT(*), COUNT(*) - COUNT(synced_at) FROM club_sync_queries").Scan(&queries, &pending)
+	return err == nil && queries > 0 && pending == 0
+}
+
+// mergeClubs appends the clubs of more that are not in clubs yet, up to limit
+func mergeClubs(clubs, more []Club, limit int) []Club {
+	seen := make(map[string]bool, len(clubs))
+	for _, club := range clubs {
+		seen[club.ID] = true
+	}
+	for _, club := range more {
+		if len(clubs) >= limit {
+			break
+		}
+		if !seen[club.ID] {
+			seen[club.ID] = true
+			clubs = append(clubs, club)
+		}
+	}
+	return clubs
+}
+
+// searchClubDirectory finds clubs whose name or city contains every word of
+// the query, ignoring case and diacritics. Names starting with the query
+// come first.
+func searchClubDirectory(query string, limit int) ([]Club, error) {
+	words := strings.Fields(normalizeSearchText(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+	var where []string
+	var args []interface{}
+	for _, word := range words {
+		where = append(where, `search_text LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(word)+"%")
+	}
+	args = append(args, escapeLike(strings.Join(words, " "))+"%", limit)
+
+	rows, err := db.Query(`
+		SELECT id, name, type, address, city, logo_url FROM clubs
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY search_text LIKE ? ESCAPE '\' DESC, name
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clubs := []Club{}
+	for rows.Next() {
+		club, err := scanDirectoryClub(rows)
+		if err != nil {
+			return nil, err
+		}
+		clubs = append(clubs, club)
+	}
+	return clubs, rows.Err()
+}
+
+// syncClubDirectory runs up to limit sync queries against source, never
+// synced queries first, then the ones synced longest ago
+func syncClubDirectory(ctx context.Context, source ClubSource, limit int, delay time.Duration) (ClubSyncResult, error) {
+	var result ClubSyncResult
+	for _, seed := range clubDirectorySeeds {
+		if _, err := db.Exec("INSERT OR IGNORE INTO club_sync_queries (query) VALUES (?)", seed); err != nil {
+			return result, err
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT query FROM club_sync_queries
+		ORDER BY synced_at IS NOT NULL, synced_at, query
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return result, err
+	}
+	var queries []string
+	for rows.Next() {
+		var q string
+		if err := rows.Scan(&q); err == nil {
+			queries = append(queries, q)
+		}
+	}
+	rows.Close()
+
+	var paused error
+	for i, q := range queries {
+		// Go easy on upstream
+		if i > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+		clubs, err := source.SearchClubs(ctx, q)
+		if errors.Is(err, ErrCircuitOpen) {
+			// Upstream is down; the rest stays pending for the next batch
+			paused = err
+			break
+		}
+		result.Queries++
+		if err != nil {
+			log.Printf("Club sync query %q failed: %v", q, err)
+			result.Failed++
+			continue
+		}
+		added, updated, err := saveDirectoryClubs(clubs)
+		if err != nil {
+			return result, err
+		}
+		result.Found += len(clubs)
+		result.Added += added
+		result.Updated += updated
+		if _, err := db.Exec("UPDATE club_sync_queries SET synced_at = ?, results = ? WHERE query = ?",
+			time.Now().UTC(), len(clubs), q); err != nil {
+			return result, err
+		}
+	}
+
+	db.QueryRow("SELECT COUNT(*) FROM club_sync_queries WHERE synced_at IS NULL").Scan(&result.Pending)
+	db.QueryRow("SELECT COUNT(*) FROM clubs").Scan(&result.Clubs)
+	if paused != nil {
+		return result, fmt.Errorf("club sync paused: %w", paused)
+	}
+	if result.Queries > 0 && result.Failed == result.Queries {
+		return result, errors.New("every club search failed")
+	}
+	return result, nil
+}
+
+// runClubSyncJob runs one batch of the directory sync in the background
+func runClubSyncJob(ctx context.Context, job *Job, lastAttempt bool) (interface{}, error) {
+	var payload clubSyncPayload
+	if err := json.Unmarshal(job.payload, &payload); err != nil {
+		return nil, permanent(fmt.Errorf("invalid job payload: %w", err))
+	}
+	if payload.Limit <= 0 {
+		payload.Limit = defaultClubSyncBatch
+	}
+	result, err := syncClubDirectory(ctx, clubSource, payload.Limit, clubSyncDelay)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ Club sync: %d queries, %d clubs added, %d updated, %d in the directory",
+		result.Queries, result.Added, result.Updated, result.Clubs)
+	return result, nil
+}
+
+// queueClubSync queues a sync batch unless one is already queued or
+// running, which is returned instead (created is false)
+func queueClubSync(limit int) (job *Job, created bool, err error) {
+	var id string
+	err = db.QueryRow("SELECT id FROM jobs WHERE kind = ? AND status IN (?, ?) ORDER BY created_at LIMIT 1",
+		JobKindClubSync, JobQueued, JobRunning).Scan(&id)
+	if err == nil {
+		job, err = loadJob(id)
+		return job, false, err
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+	job, err = enqueueLockedJob("", JobKindClubSync, "", clubSyncJobKey, &clubSyncPayload{Limit: limit})
+	return job, err == nil, err
+}
+
+// startClubSync queues a sync batch every CLUB_SYNC_INTERVAL (6h by
+// default, 0 disables), starting now unless a batch ran recently
+func startClubSync(ctx context.Context) error {
+	interval, err := envDuration("CLUB_SYNC_INTERVAL", defaultClubSyncInterval)
+	if err != nil || interval == 0 {
+		return err
+	}
+
+	var last sql.NullString
+	db.QueryRow("SELECT MAX(created_at) FROM jobs WHERE kind = ?", JobKindClubSync).Scan(&last)
+	wait := time.Duration(0)
+	if t, err := time.Parse("2006-01-02 15:04:05", last.String); err == nil && time.Since(t) < interval {
+		wait = interval - time.Since(t)
+	}
+
+	go func() {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+			if _, _, err := queueClubSync(defaultClubSyncBatch); err != nil {
+				log.Printf("Failed to queue club sync: %v", err)
+			}
+			timer.Reset(interval)
+		}
+	}()
+	return nil
+}
+
+// ==================== Club Directory Handlers ====================
+
+// startClubSyncHandler queues a sync batch of up to limit queries
+func startClubSyncHandler(c *gin.Context) {
+	limit := defaultClubSyncBatch
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxClubSyncBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxClubSyncBatch)})
+			return
+		}
+		limit = l
+	}
+
+	job, created, err := queueClubSync(limit)
+	if err != nil {
+		log.Printf("Failed to queue club sync: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue club sync"})
+		return
+	}
+	status, message := http.StatusAccepted, "club sync queued"
+	if !created {
+		status, message = http.StatusOK, "a club sync is already queued"
+	}
+	c.JSON(status, gin.H{
+		"success":    true,
+		"job":        job,
+		"status_url": jobStatusURL(c, job.ID),
+		"message":    message,
+	})
+}
+
+// getClubDirectoryStatus reports the size of the directory and the
+// progress of the sync
+func getClubDirectoryStatus(c *gin.Context) {
+	var clubs, queries, pending int
+	var lastSynced sql.NullTime
+	err := db.QueryRow("SELECT COUNT(*) FROM clubs").Scan(&clubs)
+	if err == nil {
+		err = db.QueryRow("SELECT COUNT(*), COUNT(*) - COUNT(synced_at) FROM club_sync_queries").Scan(&queries, &pending)
+	}
+	if err == nil {
+		err = db.QueryRow("SELECT synced_at FROM club_sync_queries WHERE synced_at IS NOT NULL ORDER BY synced_at DESC LIMIT 1").Scan(&lastSynced)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	status := gin.H{
+		"clubs":           clubs,
+		"queries":         queries,
+		"pending_queries": pending,
+		"last_synced_at":  nil,
+		"last_job":        nil,
+	}
+	if lastSynced.Valid {
+		status["last_synced_at"] = lastSynced.Time
+	}
+	var jobID string
+	if db.QueryRow("SELECT id FROM jobs WHERE kind = ? ORDER BY created_at DESC LIMIT 1", JobKindClubSync).Scan(&jobID) == nil {
+		if job, err := loadJob(jobID); err == nil {
+			status["last_job"] = job
+		}
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// ErrClubNotFound is returned by club sources that know a club does not exist
+var ErrClubNotFound = errors.New("club not found")
+
+// ClubSource looks up clubs in an upstream directory. Lookups stop when ctx
+// is done.
+type ClubSource interface {
+	Name() string
+	SearchClubs(ctx context.Context, query string) ([]Club, error)
+	GetClub(ctx context.Context, id string) (*Club, error)
+}
+
+// clubSource serves club search and lookups; see newClubSourceFromEnv
+var clubSource ClubSource
+
+// Default upstream base URLs
+const (
+	defaultFACRAPIURL       = "https://facr.tdvorak.dev"
+	defaultFotbalCZURL      = "https://www.fotbal.cz"
+	defaultFotbalCZMediaURL = "https://is1.fotbal.cz"
+)
+
+// envURL reads a base URL from the environment
+func envURL(name, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return fallback
+}
+
+// newClubSourceFromEnv builds the club sources listed in CLUB_SOURCES
+// ("fotbal,facr" by default), tried in that order, sending their requests
+// through client
+func newClubSourceFromEnv(client *UpstreamClient) (ClubSource, error) {
+	names := os.Getenv("CLUB_SOURCES")
+	if strings.TrimSpace(names) == "" {
+		names = "fotbal,facr"
+	}
+
+	var chain clubSourceChain
+	for _, name := range strings.Split(names, ",") {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "fotbal":
+			chain = append(chain, NewFotbalScraper(client,
+				envURL("FOTBAL_CZ_URL", defaultFotbalCZURL),
+				envURL("FOTBAL_CZ_MEDIA_URL", defaultFotbalCZMediaURL)))
+		case "facr":
+			chain = append(chain, NewFACRClient(client, envURL("FACR_API_URL", defaultFACRAPIURL)))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown club source %q in CLUB_SOURCES", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("CLUB_SOURCES lists no club source")
+	}
+	log.Printf("⚽ Club sources: %s", chain.Name())
+	return chain, nil
+}
+
+// clubSourceChain tries its sources in order until one has an answer
+type clubSourceChain []ClubSource
+
+func (chain clubSourceChain) Name() string {
+	names := make([]string, len(chain))
+	for i, source := range chain {
+		names[i] = source.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// SearchClubs returns the results of the first source that finds any club.
+// It fails only when every source failed.
+func (chain clubSourceChain) SearchClubs(ctx context.Context, query string) ([]Club, error) {
+	var errs []error
+	for _, source := range chain {
+		clubs, err := source.SearchClubs(ctx, query)
+		if err != nil {
+			log.Printf("Club search on %s failed: %v", source.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+			continue
+		}
+		if len(clubs) > 0 {
+			return clubs, nil
+		}
+	}
+	if len(errs) == len(chain) {
+		return nil, errors.Join(errs...)
+	}
+	return []Club{}, nil
+}
+
+// GetClub returns the club from the first source that has it. The error is
+// ErrClubNotFound when no source failed.
+func (chain clubSourceChain) GetClub(ctx context.Context, id string) (*Club, error) {
+	var errs []error
+	for _, source := range chain {
+		club, err := source.GetClub(ctx, id)
+		if err == nil {
+			return club, nil
+		}
+		if !errors.Is(err, ErrClubNotFound) {
+			log.Printf("Club lookup on %s failed: %v", source.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name(), err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrClubNotFound
+	}
+	return nil, errors.Join(errs...)
+}
+
+// fetchClubByID looks up a club in the club directory, then in the
+// configured club sources through the club cache
+func fetchClubByID(ctx context.Context, id string) (*Club, error) {
+	if club, err := lookupDirectoryClub(id); err == nil {
+		return club, nil
+	}
+	club, err := clubCache.GetClub(ctx, id)
+	if err == nil {
+		saveDirectoryClubs([]Club{*club})
+	}
+	return club, err
+}
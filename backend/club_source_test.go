@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	testFootballClubID = "11111111-2222-3333-4444-555555555555"
+	testFutsalClubID   = "f0f0f0f0-1111-2222-3333-444444444444"
+	testUnknownClubID  = "deadbeef-0000-0000-0000-000000000000"
+)
+
+// testUpstream serves the mock upstream and records the paths requested
+type testUpstream struct {
+	server *httptest.Server
+	client *UpstreamClient
+
+	mu    sync.Mutex
+	paths []string
+}
+
+// newTestUpstream starts the mock upstream with the given sources failing.
+// Requests are neither retried nor stopped by a circuit breaker.
+func newTestUpstream(t *testing.T, failing ...string) *testUpstream {
+	t.Helper()
+	mock := &mockUpstream{clubs: mockClubs, failing: map[string]bool{}}
+	for _, source := range failing {
+		mock.failing[source] = true
+	}
+	u := &testUpstream{}
+	u.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.mu.Lock()
+		u.paths = append(u.paths, r.URL.Path)
+		u.mu.Unlock()
+		mock.ServeHTTP(w, r)
+	}))
+	t.Cleanup(u.server.Close)
+	u.client = &UpstreamClient{
+		httpClient:  u.server.Client(),
+		rateLimit:   rate.Limit(1000),
+		maxAttempts: 1,
+		threshold:   1000,
+		cooldown:    time.Minute,
+		hosts:       make(map[string]*upstreamHost),
+	}
+	return u
+}
+
+func (u *testUpstream) fotbal() *FotbalScraper {
+	return NewFotbalScraper(u.client, u.server.URL, u.server.URL)
+}
+
+func (u *testUpstream) facr() *FACRClient {
+	return NewFACRClient(u.client, u.server.URL)
+}
+
+func (u *testUpstream) requested() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.paths...)
+}
+
+func TestFotbalScraperGetClub(t *testing.T) {
+	tests := []struct {
+		id       string
+		wantName string
+		wantType string
+		wantCity string
+		paths    []string
+	}{
+		{
+			id:       testFootballClubID,
+			wantName: "SK Slavia Praha",
+			wantType: "football",
+			wantCity: "Praha",
+			paths:    []string{"/souteze/club/club/" + testFootballClubID},
+		},
+		{
+			id:       testFutsalClubID,
+			wantName: "FK Chrudim",
+			wantType: "futsal",
+			wantCity: "Chrudim",
+			paths:    []string{"/souteze/club/club/" + testFutsalClubID, "/futsal/club/club/" + testFutsalClubID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wantType, func(t *testing.T) {
+			u := newTestUpstream(t)
+			club, err := u.fotbal().GetClub(context.Background(), tt.id)
+			if err != nil {
+				t.Fatalf("GetClub: %v", err)
+			}
+			if club.ID != tt.id || club.Name != tt.wantName || club.Type != tt.wantType || club.City != tt.wantCity {
+				t.Errorf("GetClub = %+v, want %s (%s) in %s", club, tt.wantName, tt.wantType, tt.wantCity)
+			}
+			if got := u.requested(); !reflect.DeepEqual(got, tt.paths) {
+				t.Errorf("requested %v, want %v", got, tt.paths)
+			}
+		})
+	}
+}
+
+func TestGetClubNotFound(t *testing.T) {
+	u := newTestUpstream(t)
+	sources := []ClubSource{u.fotbal(), u.facr(), clubSourceChain{u.fotbal(), u.facr()}}
+	for _, source := range sources {
+		t.Run(source.Name(), func(t *testing.T) {
+			club, err := source.GetClub(context.Background(), testUnknownClubID)
+			if !errors.Is(err, ErrClubNotFound) {
+				t.Fatalf("GetClub = %+v, %v, want ErrClubNotFound", club, err)
+			}
+		})
+	}
+}
+
+func TestClubSourceChainFallback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("search", func(t *testing.T) {
+		u := newTestUpstream(t, "fotbal")
+		clubs, err := clubSourceChain{u.fotbal(), u.facr()}.SearchClubs(ctx, "Slavia")
+		if err != nil {
+			t.Fatalf("SearchClubs: %v", err)
+		}
+		if len(clubs) != 1 || clubs[0].ID != testFootballClubID {
+			t.Errorf("SearchClubs = %+v, want SK Slavia Praha from facr", clubs)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		u := newTestUpstream(t, "facr")
+		club, err := clubSourceChain{u.facr(), u.fotbal()}.GetClub(ctx, testFutsalClubID)
+		if err != nil {
+			t.Fatalf("GetClub: %v", err)
+		}
+		if club.Name != "FK Chrudim" || club.Type != "futsal" {
+			t.Errorf("GetClub = %+v, want FK Chrudim from fotbal", club)
+		}
+	})
+
+	t.Run("unknown club with a failing source", func(t *testing.T) {
+		// A failing source may know the club, so the chain cannot say it does not exist
+		u := newTestUpstream(t, "fotbal")
+		_, err := clubSourceChain{u.fotbal(), u.facr()}.GetClub(ctx, testUnknownClubID)
+		if err == nil || errors.Is(err, ErrClubNotFound) {
+			t.Errorf("GetClub error = %v, want an upstream error", err)
+		}
+	})
+
+	t.Run("every source failing", func(t *testing.T) {
+		u := newTestUpstream(t, "fotbal", "facr")
+		chain := clubSourceChain{u.fotbal(), u.facr()}
+		if clubs, err := chain.SearchClubs(ctx, "Slavia"); err == nil {
+			t.Errorf("SearchClubs = %+v, want an error", clubs)
+		}
+		if club, err := chain.GetClub(ctx, testFootballClubID); err == nil || errors.Is(err, ErrClubNotFound) {
+			t.Errorf("GetClub = %+v, %v, want an upstream error", club, err)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Length of the content hash prefix used in immutable logo URLs
+const contentHashURLLength = 16
+
+type cachedHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// objectHashes memoizes content hashes by storage key; entries are
+// invalidated when the object's modification time or size changes.
+var objectHashes sync.Map
+
+// isContentHashPrefix tells whether s can be a prefix of a content hash as
+// used in logo URLs: at least contentHashURLLength lowercase hex digits
+func isContentHashPrefix(s string) bool {
+	if len(s) < contentHashURLLength || len(s) > sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// hashBytes returns the hex SHA-256 of data
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex SHA-256 of a local file's content
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedContentHash returns the remembered hash of an object, if its
+// modification time and size still match
+func cachedContentHash(info ObjectInfo) (string, bool) {
+	v, ok := objectHashes.Load(info.Key)
+	if !ok {
+		return "", false
+	}
+	cached := v.(cachedHash)
+	if !cached.modTime.Equal(info.ModTime) || cached.size != info.Size {
+		return "", false
+	}
+	return cached.hash, true
+}
+
+func rememberContentHash(info ObjectInfo, hash string) {
+	objectHashes.Store(info.Key, cachedHash{modTime: info.ModTime, size: info.Size, hash: hash})
+}
+
+// storedContentHash returns the hex SHA-256 of a stored object's content
+func storedContentHash(ctx context.Context, key string) (string, error) {
+	info, err := store.Stat(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if hash, ok := cachedContentHash(info); ok {
+		return hash, nil
+	}
+
+	data, info, err := readObject(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	hash := hashBytes(data)
+	rememberContentHash(info, hash)
+	return hash, nil
+}
+
+// strongETag formats a content hash as a strong entity tag
+func strongETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// immutableLogoURLs builds content-addressed URLs for every format that can
+// be served for a logo. Raster formats derive from the PNG master, or from
+// the SVG when the logo has no PNG.
+func immutableLogoURLs(baseURL, id, pngHash, svgHash string) map[string]string {
+	urls := map[string]string{}
+	if svgHash != "" {
+		urls["svg"] = fmt.Sprintf("%s/logos/%s/%s.svg", baseURL, id, svgHash[:contentHashURLLength])
+	}
+	rasterHash := pngHash
+	if rasterHash == "" {
+		rasterHash = svgHash
+	}
+	if rasterHash == "" {
+		return urls
+	}
+	if pngHash != "" {
+		urls["png"] = fmt.Sprintf("%s/logos/%s/%s.png", baseURL, id, pngHash[:contentHashURLLength])
+	}
+	for _, f := range derivedFormats {
+		if f.Available() {
+			urls[f.Name] = fmt.Sprintf("%s/logos/%s/%s%s", baseURL, id, rasterHash[:contentHashURLLength], f.Ext)
+		}
+	}
+	return urls
+}
+
+// backfillLogoHashes computes content hashes for logos stored before hashes
+// were tracked, so their immutable URLs can be served.
+func backfillLogoHashes(ctx context.Context) error {
+	rows, err := db.Query("SELECT id FROM logos WHERE (has_png = 1 AND png_hash IS NULL) OR (has_svg = 1 AND svg_hash IS NULL)")
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		pngHash := nullableStoredHash(ctx, logoKey("png", id))
+		svgHash := nullableStoredHash(ctx, logoKey("svg", id))
+		if _, err := db.Exec("UPDATE logos SET png_hash = ?, svg_hash = ? WHERE id = ?", pngHash, svgHash, id); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("✓ Computed content hashes for %d logos", len(ids))
+	}
+	return nil
+}
+
+// nullableStoredHash returns the content hash of a stored object, or NULL
+// when it is missing
+func nullableStoredHash(ctx context.Context, key string) sql.NullString {
+	hash, err := storedContentHash(ctx, key)
+	if err != nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: hash, Valid: true}
+}
+
+// notModified evaluates If-None-Match (or, without it, If-Modified-Since)
+// against the current ETag and modification time
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !modTime.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Coverage report limits. PNG-only logos whose crest is smaller than
+// min_size pixels on its longer side count as low resolution; those whose
+// crest has not been measured yet are listed as of unknown resolution.
+const (
+	defaultCoverageMinSize = 256
+	defaultCoverageLimit   = 100
+	maxCoverageLimit       = 1000
+)
+
+// postalRegions names the Czech postal regions by the first digit of the
+// postal code (PSČ). Club addresses carry no kraj, so regions are these.
+var postalRegions = map[string]string{
+	"1": "Praha",
+	"2": "Střední Čechy",
+	"3": "Západní a jižní Čechy",
+	"4": "Severní Čechy",
+	"5": "Východní Čechy",
+	"6": "Jižní Morava",
+	"7": "Severní Morava",
+}
+
+// postalCode matches a PSČ such as "110 00" or "11000" in an address
+var postalCode = regexp.MustCompile(`\b([1-7])\d{2} ?\d{2}\b`)
+
+// postalRegion returns the postal region digit of an address, "" when the
+// address has no postal code
+func postalRegion(address string) string {
+	if m := postalCode.FindStringSubmatch(address); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// CoverageFilter selects the clubs of a coverage report. City is matched
+// ignoring case and diacritics; Region is a postal region digit.
+type CoverageFilter struct {
+	ClubType string `json:"club_type,omitempty"`
+	City     string `json:"city,omitempty"`
+	Region   string `json:"region,omitempty"`
+	MinSize  int    `json:"min_size"`
+}
+
+// CoverageClub is a club listed in a coverage report. Missing logos carry
+// the club's logo on FAČR, a starting point for an import.
+type CoverageClub struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	City        string `json:"city,omitempty"`
+	Region      string `json:"region,omitempty"`
+	FACRLogoURL string `json:"facr_logo_url,omitempty"`
+	PNGSize     int    `json:"png_size,omitempty"`
+}
+
+// CoverageReport compares the club directory with the stored logos. The
+// counts are complete, the lists are cut at the report limit.
+type CoverageReport struct {
+	Filter            CoverageFilter `json:"filter"`
+	Clubs             int            `json:"clubs"`
+	WithLogo          int            `json:"with_logo"`
+	Coverage          float64        `json:"coverage"`
+	Missing           []CoverageClub `json:"missing"`
+	MissingSVG        []CoverageClub `json:"missing_svg"`
+	LowResolution     []CoverageClub `json:"low_resolution"`
+	UnknownResolution []CoverageClub `json:"unknown_resolution"`
+	Counts            map[string]int `json:"counts"`
+	Unlisted          int            `json:"logos_outside_directory"`
+	Warning           string         `json:"warning,omitempty"`
+}
+
+// buildCoverageReport joins the club directory with the logos table. limit
+// caps each list, 0 lists everything.
+func buildCoverageReport(filter CoverageFilter, limit int) (*CoverageReport, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name, c.type, c.address, c.city, c.logo_url,
+		       COALESCE(l.has_svg, 0), COALESCE(l.has_png, 0), l.bbox
+		FROM clubs c LEFT JOIN logos l ON l.id = c.id
+		WHERE ? = '' OR c.type = ?
+		ORDER BY c.name, c.id
+	`, filter.ClubType, filter.ClubType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &CoverageReport{
+		Filter:            filter,
+		Missing:           []CoverageClub{},
+		MissingSVG:        []CoverageClub{},
+		LowResolution:     []CoverageClub{},
+		UnknownResolution: []CoverageClub{},
+		Counts:            map[string]int{"missing": 0, "missing_svg": 0, "low_resolution": 0, "unknown_resolution": 0},
+	}
+	list := func(name string, items *[]CoverageClub, club CoverageClub) {
+		report.Counts[name]++
+		if limit == 0 || len(*items) < limit {
+			*items = append(*items, club)
+		}
+	}
+	city := normalizeSearchText(strings.TrimSpace(filter.City))
+	for rows.Next() {
+		var club CoverageClub
+		var typ, address, clubCity, logoURL, bbox sql.NullString
+		var hasSVG, hasPNG bool
+		if err := rows.Scan(&club.ID, &club.Name, &typ, &address, &clubCity, &logoURL, &hasSVG, &hasPNG, &bbox); err != nil {
+			return nil, err
+		}
+		region := postalRegion(address.String)
+		if city != "" && normalizeSearchText(clubCity.String) != city {
+			continue
+		}
+		if filter.Region != "" && region != filter.Region {
+			continue
+		}
+		club.Type, club.City = typ.String, clubCity.String
+		club.Region = postalRegions[region]
+
+		report.Clubs++
+		if !hasSVG && !hasPNG {
+			club.FACRLogoURL = logoURL.String
+			list("missing", &report.Missing, club)
+			continue
+		}
+		report.WithLogo++
+		if hasSVG {
+			continue
+		}
+		if b := decodeBounds(bbox); b != nil {
+			club.PNGSize = max(b.Width, b.Height)
+		}
+		list("missing_svg", &report.MissingSVG, club)
+		switch {
+		case club.PNGSize == 0:
+			// Not measured yet, or the PNG could not be read
+			list("unknown_resolution", &report.UnknownResolution, club)
+		case club.PNGSize < filter.MinSize:
+			list("low_resolution", &report.LowResolution, club)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if report.Clubs > 0 {
+		report.Coverage = math.Round(float64(report.WithLogo)/float64(report.Clubs)*10000) / 10000
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM logos WHERE id NOT IN (SELECT id FROM clubs)").Scan(&report.Unlisted); err != nil {
+		return nil, err
+	}
+	var directory int
+	if err := db.QueryRow("SELECT COUNT(*) FROM clubs").Scan(&directory); err != nil {
+		return nil, err
+	}
+	if directory == 0 {
+		report.Warning = "the club directory is empty, run a club sync first"
+	}
+	return report, nil
+}
+
+// parseCoverageFilter validates the filter options shared by the endpoint
+// and the CLI
+func parseCoverageFilter(clubType, city, region, minSize string) (CoverageFilter, error) {
+	filter := CoverageFilter{
+		ClubType: strings.ToLower(strings.TrimSpace(clubType)),
+		City:     strings.TrimSpace(city),
+		Region:   strings.TrimSpace(region),
+		MinSize:  defaultCoverageMinSize,
+	}
+	if filter.ClubType != "" && filter.ClubType != "football" && filter.ClubType != "futsal" {
+		return filter, fmt.Errorf("club_type must be football or futsal")
+	}
+	if _, ok := postalRegions[filter.Region]; filter.Region != "" && !ok {
+		return filter, fmt.Errorf("region must be a postal region digit from 1 to 7")
+	}
+	if minSize != "" {
+		v, err := strconv.Atoi(minSize)
+		if err != nil || v < 1 {
+			return filter, fmt.Errorf("invalid min_size %q", minSize)
+		}
+		filter.MinSize = v
+	}
+	return filter, nil
+}
+
+// ==================== Coverage Handlers ====================
+
+// getCoverage reports which clubs of the directory have no logo, no SVG or
+// only a small PNG
+func getCoverage(c *gin.Context) {
+	filter, err := parseCoverageFilter(c.Query("club_type"), c.Query("city"), c.Query("region"), c.Query("min_size"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := defaultCoverageLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxCoverageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxCoverageLimit)})
+			return
+		}
+		limit = l
+	}
+
+	report, err := buildCoverageReport(filter, limit)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -1,33 +1,65 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"strings"
-	"time"
 )
 
-const FACR_API_BASE = "https://facr.tdvorak.dev"
-
+// FACRClient is the club source backed by the FAČR JSON API
+// (FACR_API_URL, https://facr.tdvorak.dev by default)
 type FACRClient struct {
-	httpClient *http.Client
+	baseURL  string
+	upstream *UpstreamClient
 }
 
-func NewFACRClient() *FACRClient {
+func NewFACRClient(upstream *UpstreamClient, baseURL string) *FACRClient {
+	upstream.Register(baseURL)
 	return &FACRClient{
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		baseURL:  baseURL,
+		upstream: upstream,
 	}
 }
 
+func (c *FACRClient) Name() string {
+	return "facr"
+}
+
+// getJSON fetches an API path into v. A 404 is reported as ErrClubNotFound.
+func (c *FACRClient) getJSON(ctx context.Context, path string, v interface{}) error {
+	resp, err := c.upstream.Get(ctx, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch from FAČR API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrClubNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("FAČR API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
 // Club represents a club from the FAČR API
 type Club struct {
 	ID      string `json:"id"`
 	Name    string `json:"name"`
 	City    string `json:"city,omitempty"`
+	Address string `json:"address,omitempty"`
 	Type    string `json:"type,omitempty"`
 	Website string `json:"website,omitempty"`
 	LogoURL string `json:"logo_url,omitempty"`
@@ -35,56 +67,42 @@ type Club struct {
 
 // FACRSearchResponse represents the search response from FAČR API
 type FACRSearchResponse struct {
-	Query   string              `json:"query"`
-	Count   int                 `json:"count"`
-	Results []FACRSearchResult  `json:"results"`
+	Query   string             `json:"query"`
+	Count   int                `json:"count"`
+	Results []FACRSearchResult `json:"results"`
 }
 
 // FACRSearchResult represents a single search result from FAČR API
 type FACRSearchResult struct {
-	Name      string `json:"name"`
-	ClubID    string `json:"club_id"`
-	ClubType  string `json:"club_type"`
-	URL       string `json:"url"`
-	LogoURL   string `json:"logo_url"`
-	Category  string `json:"category"`
-	Address   string `json:"address"`
+	Name     string `json:"name"`
+	ClubID   string `json:"club_id"`
+	ClubType string `json:"club_type"`
+	URL      string `json:"url"`
+	LogoURL  string `json:"logo_url"`
+	Category string `json:"category"`
+	Address  string `json:"address"`
 }
 
 // FACRClubResponse represents the club details response from FAČR API
 type FACRClubResponse struct {
-	Name            string `json:"name"`
-	ClubID          string `json:"club_id"`
-	ClubType        string `json:"club_type"`
-	ClubInternalID  string `json:"club_internal_id"`
-	URL             string `json:"url"`
-	LogoURL         string `json:"logo_url"`
-	Address         string `json:"address"`
-	Category        string `json:"category"`
+	Name           string `json:"name"`
+	ClubID         string `json:"club_id"`
+	ClubType       string `json:"club_type"`
+	ClubInternalID string `json:"club_internal_id"`
+	URL            string `json:"url"`
+	LogoURL        string `json:"logo_url"`
+	Address        string `json:"address"`
+	Category       string `json:"category"`
 }
 
 // SearchClubs searches for clubs by query
-func (c *FACRClient) SearchClubs(query string) ([]Club, error) {
-	url := fmt.Sprintf("%s/club/search?q=%s", FACR_API_BASE, query)
-
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch from FAČR API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("FAČR API returned status %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
+func (c *FACRClient) SearchClubs(ctx context.Context, query string) ([]Club, error) {
 	var searchResp FACRSearchResponse
-	if err := json.Unmarshal(body, &searchResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if err := c.getJSON(ctx, "/club/search?q="+neturl.QueryEscape(query), &searchResp); err != nil {
+		if err == ErrClubNotFound {
+			return []Club{}, nil
+		}
+		return nil, err
 	}
 
 	// Convert FACR results to our Club format
@@ -92,11 +110,12 @@ func (c *FACRClient) SearchClubs(query string) ([]Club, error) {
 	for _, result := range searchResp.Results {
 		// Extract city from address if available
 		city := extractCityFromAddress(result.Address)
-		
+
 		clubs = append(clubs, Club{
 			ID:      result.ClubID,
 			Name:    result.Name,
 			City:    city,
+			Address: result.Address,
 			Type:    result.ClubType,
 			Website: "", // Not provided in search results
 			LogoURL: result.LogoURL,
@@ -128,37 +147,28 @@ func extractCityFromAddress(address string) string {
 }
 
 // GetClub gets a club by ID
-func (c *FACRClient) GetClub(id string) (*Club, error) {
+func (c *FACRClient) GetClub(ctx context.Context, id string) (*Club, error) {
 	// Try football first, then futsal
-	url := fmt.Sprintf("%s/club/football/%s", FACR_API_BASE, id)
-
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch from FAČR API: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("FAČR API returned status %d", resp.StatusCode)
+	var clubResp FACRClubResponse
+	err := c.getJSON(ctx, "/club/football/"+neturl.PathEscape(id), &clubResp)
+	if err == ErrClubNotFound {
+		err = c.getJSON(ctx, "/club/futsal/"+neturl.PathEscape(id), &clubResp)
 	}
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
-
-	var clubResp FACRClubResponse
-	if err := json.Unmarshal(body, &clubResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if clubResp.Name == "" {
+		return nil, ErrClubNotFound
 	}
 
 	// Extract city from address
 	city := extractCityFromAddress(clubResp.Address)
 
 	club := &Club{
-		ID:      clubResp.ClubID,
+		ID:      id,
 		Name:    clubResp.Name,
 		City:    city,
+		Address: clubResp.Address,
 		Type:    clubResp.ClubType,
 		Website: "", // Not provided in FACR API
 		LogoURL: clubResp.LogoURL,
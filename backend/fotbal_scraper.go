@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FotbalScraper is the club source scraping the fotbal.cz club pages
+// (FOTBAL_CZ_URL). Club logos are served from FOTBAL_CZ_MEDIA_URL.
+type FotbalScraper struct {
+	baseURL  string
+	mediaURL string
+	upstream *UpstreamClient
+}
+
+func NewFotbalScraper(upstream *UpstreamClient, baseURL, mediaURL string) *FotbalScraper {
+	upstream.Register(baseURL)
+	return &FotbalScraper{
+		baseURL:  baseURL,
+		mediaURL: mediaURL,
+		upstream: upstream,
+	}
+}
+
+func (s *FotbalScraper) Name() string {
+	return "fotbal"
+}
+
+// SearchClubs scrapes the fotbal.cz club search. A query the search
+// rejects is tried once more in quotes.
+func (s *FotbalScraper) SearchClubs(ctx context.Context, q string) ([]Club, error) {
+	header := http.Header{}
+	header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
+	header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
+	header.Set("Accept-Language", "cs-CZ,cs;q=0.9,en;q=0.8")
+
+	vals := neturl.Values{}
+	vals.Set("q", q)
+	resp, err := s.upstream.Get(ctx, s.baseURL+"/club/hledej?"+vals.Encode(), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		vals2 := neturl.Values{}
+		vals2.Set("q", "\""+q+"\"")
+		resp2, err2 := s.upstream.Get(ctx, s.baseURL+"/club/hledej?"+vals2.Encode(), header)
+		if err2 != nil {
+			return nil, err2
+		}
+		defer resp2.Body.Close()
+		resp = resp2
+	}
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("fotbal.cz returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return []Club{}, nil
+	}
+	buf := new(bytes.Buffer)
+	_, _ = buf.ReadFrom(resp.Body)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	clubs := []Club{}
+	doc.Find("li.ListItemSplit").Each(func(_ int, li *goquery.Selection) {
+		a := li.Find("a.Link--inverted").First()
+		href := strings.TrimSpace(a.AttrOr("href", ""))
+		if href == "" {
+			return
+		}
+		name := strings.TrimSpace(a.Find("span.H7").First().Text())
+		if name == "" {
+			name = strings.TrimSpace(a.Text())
+		}
+		logoURL := strings.TrimSpace(a.Find("img").First().AttrOr("src", ""))
+		address := strings.TrimSpace(li.Find(".ClubAddress p").First().Text())
+		clubType := "football"
+		if strings.Contains(strings.ToLower(href), "/futsal/") {
+			clubType = "futsal"
+		}
+		parts := strings.Split(strings.TrimRight(href, "/"), "/")
+		clubID := ""
+		if len(parts) > 0 {
+			clubID = parts[len(parts)-1]
+		}
+		city := extractCityFromAddress(address)
+		clubs = append(clubs, Club{ID: clubID, Name: name, City: city, Address: address, Type: clubType, Website: "", LogoURL: logoURL})
+	})
+	return clubs, nil
+}
+
+// GetClub scrapes the club page, trying football first, then futsal
+func (s *FotbalScraper) GetClub(ctx context.Context, id string) (*Club, error) {
+	tryFetch := func(path string, typ string) (*Club, error) {
+		header := http.Header{}
+		header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
+		header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		header.Set("Accept-Language", "cs-CZ,cs;q=0.9,en;q=0.8")
+		resp, err := s.upstream.Get(ctx, fmt.Sprintf("%s%s/%s", s.baseURL, path, neturl.PathEscape(id)), header)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrClubNotFound
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fotbal.cz returned status %d", resp.StatusCode)
+		}
+		doc, err := goquery.NewDocumentFromReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSpace(doc.Find("h1.H4 span").First().Text())
+		if name == "" {
+			return nil, ErrClubNotFound
+		}
+		address := strings.TrimSpace(doc.Find(".ClubAddress p").First().Text())
+		city := extractCityFromAddress(address)
+		logo := fmt.Sprintf("%s/media/kluby/%s/%s_crop.jpg", s.mediaURL, id, id)
+		return &Club{ID: id, Name: name, City: city, Address: address, Type: typ, Website: "", LogoURL: logo}, nil
+	}
+	club, err := tryFetch("/souteze/club/club", "football")
+	if err == nil {
+		return club, nil
+	}
+	club, err2 := tryFetch("/futsal/club/club", "futsal")
+	if err2 == nil {
+		return club, nil
+	}
+	// Not found needs both pages to say so
+	if err == ErrClubNotFound {
+		return nil, err2
+	}
+	return nil, err
+}
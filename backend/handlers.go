@@ -2,11 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net/http"
-	neturl "net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -15,7 +19,6 @@ import (
 
 	"unicode"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/text/unicode/norm"
@@ -30,19 +33,48 @@ func searchClubs(c *gin.Context) {
 		return
 	}
 
-	clubs, err := scrapeFotbalSearch(q)
+	// The local directory answers without asking upstream once the sync has
+	// run all its queries. Until then it may miss clubs, so its matches are
+	// merged with the club sources' and only serve alone when those fail.
+	directory, err := searchClubDirectory(q, maxClubDirectoryResults)
+	if err != nil {
+		log.Printf("Club directory search failed: %v", err)
+	} else if len(directory) > 0 && clubDirectoryComplete() {
+		c.Header("X-Club-Source", "directory")
+		c.JSON(http.StatusOK, directory)
+		return
+	}
+
+	c.Header("X-Club-Source", "upstream")
+	clubs, cache, err := clubCache.Search(c.Request.Context(), q)
+	cache.setHeaders(c)
 	if err != nil || len(clubs) == 0 {
 		nq := removeDiacritics(strings.ToLower(q))
 		if nq != strings.ToLower(q) {
-			if c2, err2 := scrapeFotbalSearch(nq); err2 == nil && len(c2) > 0 {
-				c.JSON(http.StatusOK, c2)
-				return
+			if c2, cache2, err2 := clubCache.Search(c.Request.Context(), nq); err2 == nil && len(c2) > 0 {
+				cache2.setHeaders(c)
+				clubs, err = c2, nil
 			}
 		}
-		c.JSON(http.StatusOK, getDemoClubs(q))
+	}
+	if err != nil && len(clubs) == 0 {
+		if len(directory) > 0 {
+			c.Header("X-Club-Source", "directory")
+			c.JSON(http.StatusOK, directory)
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "club search failed"})
 		return
 	}
 
+	// Clubs found upstream join the directory
+	if _, _, err := saveDirectoryClubs(clubs); err != nil {
+		log.Printf("Failed to add clubs to the directory: %v", err)
+	}
+	if len(directory) > 0 {
+		c.Header("X-Club-Source", "directory+upstream")
+		clubs = mergeClubs(directory, clubs, maxClubDirectoryResults)
+	}
 	c.JSON(http.StatusOK, clubs)
 }
 
@@ -53,115 +85,26 @@ func getClub(c *gin.Context) {
 		return
 	}
 
-	club, err := fetchClubByID(id)
-	if err != nil || club == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "club not found"})
+	if club, err := lookupDirectoryClub(id); err == nil {
+		c.Header("X-Club-Source", "directory")
+		c.JSON(http.StatusOK, club)
 		return
 	}
 
-	c.JSON(http.StatusOK, club)
-}
-
-func scrapeFotbalSearch(q string) ([]Club, error) {
-	vals := neturl.Values{}
-	vals.Set("q", q)
-	searchURL := "https://www.fotbal.cz/club/hledej?" + vals.Encode()
-	req, _ := http.NewRequest("GET", searchURL, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "cs-CZ,cs;q=0.9,en;q=0.8")
-	client := &http.Client{Timeout: 12 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	c.Header("X-Club-Source", "upstream")
+	club, cache, err := clubCache.Lookup(c.Request.Context(), id)
+	cache.setHeaders(c)
+	if errors.Is(err, ErrClubNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "club not found"})
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		vals2 := neturl.Values{}
-		vals2.Set("q", "\""+q+"\"")
-		searchURL = "https://www.fotbal.cz/club/hledej?" + vals2.Encode()
-		req2, _ := http.NewRequest("GET", searchURL, nil)
-		req2.Header = req.Header.Clone()
-		resp2, err2 := client.Do(req2)
-		if err2 != nil {
-			return nil, err2
-		}
-		defer resp2.Body.Close()
-		if resp2.StatusCode != http.StatusOK {
-			return []Club{}, nil
-		}
-		resp = resp2
-	}
-	buf := new(bytes.Buffer)
-	_, _ = buf.ReadFrom(resp.Body)
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(buf.Bytes()))
 	if err != nil {
-		return nil, err
+		c.JSON(http.StatusBadGateway, gin.H{"error": "club lookup failed"})
+		return
 	}
-	clubs := []Club{}
-	doc.Find("li.ListItemSplit").Each(func(_ int, li *goquery.Selection) {
-		a := li.Find("a.Link--inverted").First()
-		href := strings.TrimSpace(a.AttrOr("href", ""))
-		if href == "" {
-			return
-		}
-		name := strings.TrimSpace(a.Find("span.H7").First().Text())
-		if name == "" {
-			name = strings.TrimSpace(a.Text())
-		}
-		logoURL := strings.TrimSpace(a.Find("img").First().AttrOr("src", ""))
-		address := strings.TrimSpace(li.Find(".ClubAddress p").First().Text())
-		clubType := "football"
-		if strings.Contains(strings.ToLower(href), "/futsal/") {
-			clubType = "futsal"
-		}
-		parts := strings.Split(strings.TrimRight(href, "/"), "/")
-		clubID := ""
-		if len(parts) > 0 {
-			clubID = parts[len(parts)-1]
-		}
-		if !strings.HasPrefix(href, "http://") && !strings.HasPrefix(href, "https://") {
-			href = "https://www.fotbal.cz" + href
-		}
-		city := extractCityFromAddress(address)
-		clubs = append(clubs, Club{ID: clubID, Name: name, City: city, Type: clubType, Website: "", LogoURL: logoURL})
-	})
-	return clubs, nil
-}
+	saveDirectoryClubs([]Club{*club})
 
-func fetchClubByID(id string) (*Club, error) {
-	tryFetch := func(base string, typ string) (*Club, error) {
-		url := fmt.Sprintf("%s/%s", base, id)
-		req, _ := http.NewRequest("GET", url, nil)
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
-		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-		req.Header.Set("Accept-Language", "cs-CZ,cs;q=0.9,en;q=0.8")
-		client := &http.Client{Timeout: 12 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("status %d", resp.StatusCode)
-		}
-		doc, err := goquery.NewDocumentFromReader(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		name := strings.TrimSpace(doc.Find("h1.H4 span").First().Text())
-		address := strings.TrimSpace(doc.Find(".ClubAddress p").First().Text())
-		city := extractCityFromAddress(address)
-		logo := fmt.Sprintf("https://is1.fotbal.cz/media/kluby/%s/%s_crop.jpg", id, id)
-		return &Club{ID: id, Name: name, City: city, Type: typ, Website: "", LogoURL: logo}, nil
-	}
-	if club, err := tryFetch("https://www.fotbal.cz/souteze/club/club", "football"); err == nil && club != nil && club.Name != "" {
-		return club, nil
-	}
-	if club, err := tryFetch("https://www.fotbal.cz/futsal/club/club", "futsal"); err == nil && club != nil && club.Name != "" {
-		return club, nil
-	}
-	return nil, fmt.Errorf("not found")
+	c.JSON(http.StatusOK, club)
 }
 
 func removeDiacritics(s string) string {
@@ -176,189 +119,41 @@ func removeDiacritics(s string) string {
 	return string(b)
 }
 
-// Demo data fallback
-func getDemoClubs(query string) []Club {
-	demoClubs := []Club{
-		{
-			ID:      "11111111-2222-3333-4444-555555555555",
-			Name:    "SK Slavia Praha",
-			City:    "Praha",
-			Type:    "football",
-			Website: "https://www.slavia.cz",
-		},
-		{
-			ID:      "22222222-3333-4444-5555-666666666666",
-			Name:    "AC Sparta Praha",
-			City:    "Praha",
-			Type:    "football",
-			Website: "https://www.sparta.cz",
-		},
-		{
-			ID:      "33333333-4444-5555-6666-777777777777",
-			Name:    "FC Viktoria Plzeň",
-			City:    "Plzeň",
-			Type:    "football",
-			Website: "https://www.fcviktoria.cz",
-		},
-		{
-			ID:      "44444444-5555-6666-7777-888888888888",
-			Name:    "FC Baník Ostrava",
-			City:    "Ostrava",
-			Type:    "football",
-			Website: "https://www.fcb.cz",
-		},
-		{
-			ID:      "55555555-6666-7777-8888-999999999999",
-			Name:    "SK Sigma Olomouc",
-			City:    "Olomouc",
-			Type:    "football",
-			Website: "https://www.sigmafotbal.cz",
-		},
-		{
-			ID:      "66666666-7777-8888-9999-aaaaaaaaaaaa",
-			Name:    "FC Slovan Liberec",
-			City:    "Liberec",
-			Type:    "football",
-			Website: "https://www.fcslovanliberec.cz",
-		},
-		{
-			ID:      "77777777-8888-9999-aaaa-bbbbbbbbbbbb",
-			Name:    "MFK Karviná",
-			City:    "Karviná",
-			Type:    "football",
-			Website: "https://www.mfkkarvina.cz",
-		},
-		{
-			ID:      "88888888-9999-aaaa-bbbb-cccccccccccc",
-			Name:    "FC Fastav Zlín",
-			City:    "Zlín",
-			Type:    "football",
-			Website: "https://www.fczlin.cz",
-		},
-		{
-			ID:      "99999999-aaaa-bbbb-cccc-dddddddddddd",
-			Name:    "FK Jablonec",
-			City:    "Jablonec nad Nisou",
-			Type:    "football",
-			Website: "https://www.fkjablonec.cz",
-		},
-		{
-			ID:      "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee",
-			Name:    "SFC Opava",
-			City:    "Opava",
-			Type:    "football",
-			Website: "https://www.sfcopava.cz",
-		},
-		{
-			ID:      "bbbbbbbb-cccc-dddd-eeee-ffffffffffff",
-			Name:    "FK Teplice",
-			City:    "Teplice",
-			Type:    "football",
-			Website: "https://www.fkteplice.cz",
-		},
-		{
-			ID:      "cccccccc-dddd-eeee-ffff-000000000000",
-			Name:    "1. FK Příbram",
-			City:    "Příbram",
-			Type:    "football",
-			Website: "https://www.1fkpribram.cz",
-		},
-		{
-			ID:      "dddddddd-eeee-ffff-0000-111111111111",
-			Name:    "SK Dynamo České Budějovice",
-			City:    "České Budějovice",
-			Type:    "football",
-			Website: "https://www.dynamocb.cz",
-		},
-		{
-			ID:      "eeeeeeee-ffff-0000-1111-222222222222",
-			Name:    "FC Zbrojovka Brno",
-			City:    "Brno",
-			Type:    "football",
-			Website: "https://www.fczbrno.cz",
-		},
-		{
-			ID:      "ffffffff-0000-1111-2222-333333333333",
-			Name:    "FC Vysočina Jihlava",
-			City:    "Jihlava",
-			Type:    "football",
-			Website: "https://www.fcvysocina.cz",
-		},
-		{
-			ID:      "00000000-1111-2222-3333-444444444444",
-			Name:    "FK Mladá Boleslav",
-			City:    "Mladá Boleslav",
-			Type:    "football",
-			Website: "https://www.fkmb.cz",
-		},
-		{
-			ID:      "10101010-1111-2222-3333-444444444444",
-			Name:    "SK Sigma Hranice",
-			City:    "Hranice",
-			Type:    "football",
-			Website: "",
-		},
-		{
-			ID:      "20202020-2222-3333-4444-555555555555",
-			Name:    "SK Hranice",
-			City:    "Hranice",
-			Type:    "football",
-			Website: "",
-		},
-		{
-			ID:      "30303030-3333-4444-5555-666666666666",
-			Name:    "TJ Krnov",
-			City:    "Krnov",
-			Type:    "football",
-			Website: "",
-		},
-	}
-
-	var results []Club
-	lowerQuery := strings.ToLower(query)
-
-	// Fuzzy matching: check contains in name, city, and partial matches
-	for _, club := range demoClubs {
-		lowerName := strings.ToLower(club.Name)
-		lowerCity := strings.ToLower(club.City)
-
-		// Exact contains match in name or city
-		if strings.Contains(lowerName, lowerQuery) || strings.Contains(lowerCity, lowerQuery) {
-			results = append(results, club)
-			continue
-		}
-
-		// Fuzzy match: check if query matches start of any word in name
-		words := strings.Fields(lowerName)
-		for _, word := range words {
-			if strings.HasPrefix(word, lowerQuery) {
-				results = append(results, club)
-				break
-			}
-		}
-	}
-
-	return results
-}
-
 // ==================== Logo Handlers ====================
 
 type LogoMetadata struct {
-	ID            string    `json:"id"`
-	ClubName      string    `json:"club_name"`
-	ClubCity      string    `json:"club_city,omitempty"`
-	ClubType      string    `json:"club_type,omitempty"`
-	ClubWebsite   string    `json:"club_website,omitempty"`
-	HasSVG        bool      `json:"has_svg"`
-	HasPNG        bool      `json:"has_png"`
-	PrimaryFormat string    `json:"primary_format"`
-	LogoURL       string    `json:"logo_url"`
-	LogoURLSVG    string    `json:"logo_url_svg,omitempty"`
-	LogoURLPNG    string    `json:"logo_url_png,omitempty"`
-	FileSizeSVG   int64     `json:"file_size_svg,omitempty"`
-	FileSizePNG   int64     `json:"file_size_png,omitempty"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID                  string            `json:"id"`
+	ClubName            string            `json:"club_name"`
+	ClubCity            string            `json:"club_city,omitempty"`
+	ClubType            string            `json:"club_type,omitempty"`
+	ClubWebsite         string            `json:"club_website,omitempty"`
+	Aliases             []string          `json:"aliases,omitempty"`
+	HasSVG              bool              `json:"has_svg"`
+	HasPNG              bool              `json:"has_png"`
+	PrimaryFormat       string            `json:"primary_format"`
+	LogoURL             string            `json:"logo_url"`
+	LogoURLSVG          string            `json:"logo_url_svg,omitempty"`
+	LogoURLPNG          string            `json:"logo_url_png,omitempty"`
+	LogoURLWebP         string            `json:"logo_url_webp,omitempty"`
+	LogoURLAVIF         string            `json:"logo_url_avif,omitempty"`
+	ImmutableURLs       map[string]string `json:"immutable_urls,omitempty"`
+	HashSVG             string            `json:"hash_svg,omitempty"`
+	HashPNG             string            `json:"hash_png,omitempty"`
+	Revision            int               `json:"revision,omitempty"`
+	APIKeyID            string            `json:"api_key_id,omitempty"`
+	FileSizeSVG         int64             `json:"file_size_svg,omitempty"`
+	FileSizePNG         int64             `json:"file_size_png,omitempty"`
+	FileSizeSVGOriginal int64             `json:"file_size_svg_original,omitempty"`
+	SourceFormat        string            `json:"source_format,omitempty"`
+	FileSizeSource      int64             `json:"file_size_source,omitempty"`
+	BackgroundRemoved   bool              `json:"background_removed"`
+	Bounds              *LogoBounds       `json:"bbox,omitempty"`
+	AspectRatio         float64           `json:"aspect_ratio,omitempty"`
+	Palette             []PaletteColor    `json:"palette,omitempty"`
+	PHash               string            `json:"phash,omitempty"`
+	ClubColors          []string          `json:"club_colors,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
 }
 
 // getLogo returns the logo file (PNG preferred, SVG fallback)
@@ -376,17 +171,141 @@ func getLogo(c *gin.Context) {
 	}
 
 	// Check format preference from query
-	format := c.Query("format") // can be "svg" or "png"
+	format := c.Query("format") // can be "svg", "png", "webp" or "avif"
+
+	// Without an explicit format, negotiate WebP/AVIF from the Accept header
+	negotiated := false
+	if format == "" {
+		c.Header("Vary", "Accept")
+		if f := negotiateLogoFormat(c.GetHeader("Accept")); f != "" {
+			format = f
+			negotiated = true
+		}
+	}
+
+	// The URL is mutable, so clients must revalidate using the ETag
+	serveLogo(c, id, format, negotiated, "public, no-cache")
+}
+
+// getLogoByHash serves /logos/:id/:hash.:ext, an immutable URL whose hash
+// must match the current content of the logo's master file.
+func getLogoByHash(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+
+	file := c.Param("file")
+	ext := filepath.Ext(file)
+	hash := strings.ToLower(strings.TrimSuffix(file, ext))
+	format := strings.TrimPrefix(ext, ".")
+	_, derived := findDerivedFormat(format)
+	if !isContentHashPrefix(hash) || (format != "png" && format != "svg" && !derived) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+
+	var pngHash, svgHash sql.NullString
+	err := db.QueryRow("SELECT png_hash, svg_hash FROM logos WHERE id = ?", id).Scan(&pngHash, &svgHash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// SVG URLs carry the SVG hash; raster formats derive from the PNG master
+	// (or the SVG for SVG-only logos)
+	masterHash := pngHash.String
+	if format == "svg" || !pngHash.Valid {
+		masterHash = svgHash.String
+	}
+	if err == sql.ErrNoRows || masterHash == "" || !strings.HasPrefix(masterHash, hash) {
+		// Older content stays reachable through its revision's master file
+		if format == "png" || format == "svg" {
+			var revision int
+			err := db.QueryRow(
+				"SELECT revision FROM logo_revisions WHERE logo_id = ? AND substr("+format+"_hash, 1, ?) = ? ORDER BY revision DESC LIMIT 1",
+				id, len(hash), hash,
+			).Scan(&revision)
+			if err == nil && c.Query("size") == "" && c.Query("w") == "" && c.Query("h") == "" {
+				contentType := "image/png"
+				if format == "svg" {
+					contentType = "image/svg+xml"
+				}
+				serveStoredObject(c, revisionKey(id, revision, format), contentType, "public, max-age=31536000, immutable")
+				return
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
 
-	var logoPath string
+	serveLogo(c, id, format, false, "public, max-age=31536000, immutable")
+}
+
+// serveLogo resolves the file for the requested format and size and serves
+// it with serveStoredObject
+func serveLogo(c *gin.Context, id, format string, negotiated bool, cacheControl string) {
+	ctx := c.Request.Context()
+
+	// Optional resizing (size, w, h); only applies to raster output
+	width, height, err := parseLogoSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "allowed_sizes": allowedLogoSizes})
+		return
+	}
+
+	var objectKey string
 	var contentType string
 	var found bool
 
+	// WebP/AVIF generated lazily from the PNG master
+	if df, ok := findDerivedFormat(format); ok {
+		if !df.Available() {
+			c.JSON(http.StatusNotImplemented, gin.H{"error": format + " output is not available on this server"})
+			return
+		}
+		derivedKey, err := ensureDerivedLogo(ctx, id, df, width, height)
+		switch {
+		case err == nil:
+			objectKey = derivedKey
+			contentType = df.ContentType
+			found = true
+		case errors.Is(err, fs.ErrNotExist):
+			c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+			return
+		case negotiated:
+			// Negotiation is best effort, fall back to PNG
+			log.Printf("Failed to encode %s for %s: %v", format, id, err)
+			format = ""
+		default:
+			log.Printf("Failed to encode %s for %s: %v", format, id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to convert logo to " + format})
+			return
+		}
+	}
+
+	// Resized PNG variant, rendered from SVG or resampled from PNG
+	if !found && (width > 0 || height > 0) && (format == "" || format == "png") {
+		variantKey, err := ensureLogoVariant(ctx, id, width, height)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to generate %dx%d variant for %s: %v", width, height, id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resize logo"})
+			return
+		}
+		if err == nil {
+			objectKey = variantKey
+			contentType = "image/png"
+			found = true
+		}
+	}
+
 	// Try PNG first (primary format)
-	if format == "" || format == "png" {
-		pngPath := filepath.Join("./logos/png", id+".png")
-		if _, err := os.Stat(pngPath); err == nil {
-			logoPath = pngPath
+	if !found && (format == "" || format == "png") {
+		pngKey := logoKey("png", id)
+		if _, err := store.Stat(ctx, pngKey); err == nil {
+			objectKey = pngKey
 			contentType = "image/png"
 			found = true
 		}
@@ -394,9 +313,9 @@ func getLogo(c *gin.Context) {
 
 	// Try SVG if PNG not found or explicitly requested
 	if !found && (format == "" || format == "svg") {
-		svgPath := filepath.Join("./logos/svg", id+".svg")
-		if _, err := os.Stat(svgPath); err == nil {
-			logoPath = svgPath
+		svgKey := logoKey("svg", id)
+		if _, err := store.Stat(ctx, svgKey); err == nil {
+			objectKey = svgKey
 			contentType = "image/svg+xml"
 			found = true
 		}
@@ -407,13 +326,52 @@ func getLogo(c *gin.Context) {
 		return
 	}
 
+	serveStoredObject(c, objectKey, contentType, cacheControl)
+}
+
+// serveStoredObject writes a stored file with a content-hash ETag.
+// Conditional requests (If-None-Match and If-Modified-Since) are answered
+// with 304 Not Modified.
+func serveStoredObject(c *gin.Context, objectKey, contentType, cacheControl string) {
+	ctx := c.Request.Context()
+	info, err := store.Stat(ctx, objectKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+
 	// Set CORS headers explicitly for file serving
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
 	c.Header("Access-Control-Allow-Headers", "*")
 	c.Header("Content-Type", contentType)
-	c.Header("Cache-Control", "public, max-age=31536000")
-	c.File(logoPath)
+	c.Header("Cache-Control", cacheControl)
+	if contentType == "image/svg+xml" {
+		// Defense in depth for SVGs stored before uploads were sanitized
+		c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:")
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
+
+	// Answer revalidations without fetching the object when its hash is known
+	if hash, ok := cachedContentHash(info); ok {
+		etag := strongETag(hash)
+		if notModified(c.Request, etag, info.ModTime) {
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	data, info, err := readObject(ctx, objectKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+	hash := hashBytes(data)
+	rememberContentHash(info, hash)
+
+	c.Header("ETag", strongETag(hash))
+	http.ServeContent(c.Writer, c.Request, objectKey, info.ModTime, bytes.NewReader(data))
 }
 
 func getLogoWithMetadata(c *gin.Context) {
@@ -432,10 +390,14 @@ func getLogoWithMetadata(c *gin.Context) {
 	// Get metadata from database
 	var metadata LogoMetadata
 	var hasSVG, hasPNG int
+	var svgHash, pngHash, apiKeyID, aliases, sourceFormat, bounds, palette, clubColors, phash sql.NullString
+	var revision, sizeSVGOriginal, sizeSource sql.NullInt64
+	var aspectRatio sql.NullFloat64
 	err := db.QueryRow(`
-		SELECT id, club_name, club_city, club_type, club_website,
+		SELECT id, club_name, club_city, club_type, club_website, club_aliases,
 		       has_svg, has_png, primary_format,
-		       file_size_svg, file_size_png,
+		       file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source, background_removed,
+		       bbox, aspect_ratio, palette, club_colors, phash, svg_hash, png_hash, current_revision, api_key_id,
 		       created_at, updated_at
 		FROM logos WHERE id = ?
 	`, id).Scan(
@@ -444,11 +406,25 @@ func getLogoWithMetadata(c *gin.Context) {
 		&metadata.ClubCity,
 		&metadata.ClubType,
 		&metadata.ClubWebsite,
+		&aliases,
 		&hasSVG,
 		&hasPNG,
 		&metadata.PrimaryFormat,
 		&metadata.FileSizeSVG,
 		&metadata.FileSizePNG,
+		&sizeSVGOriginal,
+		&sourceFormat,
+		&sizeSource,
+		&metadata.BackgroundRemoved,
+		&bounds,
+		&aspectRatio,
+		&palette,
+		&clubColors,
+		&phash,
+		&svgHash,
+		&pngHash,
+		&revision,
+		&apiKeyID,
 		&metadata.CreatedAt,
 		&metadata.UpdatedAt,
 	)
@@ -466,6 +442,19 @@ func getLogoWithMetadata(c *gin.Context) {
 
 	metadata.HasSVG = hasSVG == 1
 	metadata.HasPNG = hasPNG == 1
+	metadata.HashSVG = svgHash.String
+	metadata.HashPNG = pngHash.String
+	metadata.Aliases = parseAliases(aliases.String)
+	metadata.FileSizeSVGOriginal = sizeSVGOriginal.Int64
+	metadata.SourceFormat = sourceFormat.String
+	metadata.FileSizeSource = sizeSource.Int64
+	metadata.Bounds = decodeBounds(bounds)
+	metadata.AspectRatio = aspectRatio.Float64
+	metadata.Palette = decodePalette(palette)
+	metadata.ClubColors = parseClubColors(clubColors.String)
+	metadata.PHash = phash.String
+	metadata.Revision = int(revision.Int64)
+	metadata.APIKeyID = apiKeyID.String
 
 	// Construct logo URLs
 	scheme := "http"
@@ -488,74 +477,142 @@ func getLogoWithMetadata(c *gin.Context) {
 	if metadata.HasPNG {
 		metadata.LogoURLPNG = fmt.Sprintf("%s/logos/%s?format=png", baseURL, id)
 	}
+	if metadata.HasPNG || metadata.HasSVG {
+		for _, f := range derivedFormats {
+			if !f.Available() {
+				continue
+			}
+			url := fmt.Sprintf("%s/logos/%s?format=%s", baseURL, id, f.Name)
+			switch f.Name {
+			case "webp":
+				metadata.LogoURLWebP = url
+			case "avif":
+				metadata.LogoURLAVIF = url
+			}
+		}
+	}
+
+	// Content-addressed URLs, safe to cache forever
+	metadata.ImmutableURLs = immutableLogoURLs(baseURL, id, metadata.HashPNG, metadata.HashSVG)
 
 	c.JSON(http.StatusOK, metadata)
 }
 
-// List all logos
+// listLogos returns a page of logos, optionally filtered by a full-text
+// query (q, which ignores diacritics and matches word prefixes) and club
+// type. Results are ranked by relevance when q is given, unless sort is set.
+// Pages are addressed with the opaque cursor of the previous page; the
+// legacy page parameter is still honoured as an offset.
 func listLogos(c *gin.Context) {
 	q := strings.TrimSpace(c.Query("q"))
-	sortParam := c.DefaultQuery("sort", "name")
-	limitStr := c.Query("limit")
-	pageStr := c.Query("page")
+	sortParam := c.Query("sort")
+	if sortParam == "" {
+		sortParam = "name"
+		if q != "" {
+			sortParam = "relevance"
+		}
+	}
+	if sortParam == "relevance" && q == "" {
+		sortParam = "name"
+	}
+	if sortParam != "name" && sortParam != "recent" && sortParam != "relevance" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort (use name, recent or relevance)"})
+		return
+	}
 	typeParam := strings.TrimSpace(strings.ToLower(c.Query("type")))
 
-	base := "SELECT id, club_name, club_city, club_type, club_website, has_svg, has_png, primary_format, created_at, updated_at FROM logos"
+	limit, err := parsePageSize(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var cursor *listCursor
+	if v := c.Query("cursor"); v != "" {
+		if cursor, err = decodeListCursor(v, sortParam); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if page, err := strconv.Atoi(c.Query("page")); err == nil && page > 1 {
+		cursor = &listCursor{Sort: sortParam, Offset: (page - 1) * limit}
+	}
+
+	join := ""
 	whereParts := []string{}
 	args := []interface{}{}
 	if q != "" {
-		like := "%" + strings.ToLower(q) + "%"
-		whereParts = append(whereParts, "(LOWER(club_name) LIKE ? OR LOWER(club_city) LIKE ? OR id LIKE ?)")
-		args = append(args, like, like, "%"+q+"%")
+		searchJoin, searchWhere, searchArgs := logoSearchJoin(q)
+		join = searchJoin
+		whereParts = append(whereParts, searchWhere)
+		args = append(args, searchArgs...)
 	}
 	if typeParam == "football" || typeParam == "futsal" {
-		whereParts = append(whereParts, "LOWER(club_type) = ?")
+		whereParts = append(whereParts, "LOWER(l.club_type) = ?")
 		args = append(args, typeParam)
 	}
+	if colorParam := c.Query("color"); colorParam != "" {
+		colorWhere, colorArgs, err := colorFilter(colorParam, c.Query("color_distance"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		whereParts = append(whereParts, colorWhere)
+		args = append(args, colorArgs...)
+	}
 	where := ""
 	if len(whereParts) > 0 {
 		where = " WHERE " + strings.Join(whereParts, " AND ")
 	}
-	order := " ORDER BY club_name"
-	if sortParam == "recent" {
-		order = " ORDER BY datetime(updated_at) DESC, datetime(created_at) DESC"
-	}
-	limitClause := ""
-	if limitStr != "" {
-		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-			limitClause = " LIMIT ?"
-			args = append(args, limit)
-			if pageStr != "" {
-				if page, err := strconv.Atoi(pageStr); err == nil {
-					if page < 1 {
-						page = 1
-					}
-					offset := (page - 1) * limit
-					limitClause += " OFFSET ?"
-					args = append(args, offset)
-				}
-			}
+
+	// Total of all matches, independent of the page
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM logos l"+join+where, args...).Scan(&total); err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	// Keyset pagination: every order ends with the ID so positions are unique
+	sortKey := "l.club_name"
+	order := " ORDER BY l.club_name, l.id"
+	after := "(l.club_name > ? OR (l.club_name = ? AND l.id > ?))"
+	switch sortParam {
+	case "recent":
+		sortKey = "datetime(l.updated_at)"
+		order = " ORDER BY datetime(l.updated_at) DESC, l.id DESC"
+		after = "(datetime(l.updated_at) < ? OR (datetime(l.updated_at) = ? AND l.id < ?))"
+	case "relevance":
+		sortKey = "''"
+		order = " ORDER BY s.rank IS NULL, s.rank, l.club_name, l.id"
+	}
+	offset := 0
+	if cursor != nil {
+		if cursor.ID != "" && sortParam != "relevance" {
+			whereParts = append(whereParts, after)
+			args = append(args, cursor.Key, cursor.Key, cursor.ID)
+			where = " WHERE " + strings.Join(whereParts, " AND ")
 		}
+		offset = cursor.Offset
 	}
+	args = append(args, limit+1, offset)
 
-	query := base + where + order + limitClause
+	query := "SELECT l.id, l.club_name, l.club_city, l.club_type, l.club_website, l.has_svg, l.has_png, l.primary_format, l.club_aliases, l.palette, l.club_colors, l.created_at, l.updated_at, " +
+		sortKey + " FROM logos l" + join + where + order + " LIMIT ? OFFSET ?"
 	rows, err := db.Query(query, args...)
 	if err != nil {
+		log.Printf("Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
 	defer rows.Close()
 
-	var logos []LogoMetadata
-	scheme := "http"
-	if c.Request.TLS != nil {
-		scheme = "https"
-	}
-	baseURL := fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+	logos := []LogoMetadata{}
+	var keys []string
+	baseURL := requestBaseURL(c)
 
 	for rows.Next() {
 		var logo LogoMetadata
 		var hasSVG, hasPNG int
+		var aliases, palette, clubColors, key sql.NullString
 		if err := rows.Scan(
 			&logo.ID,
 			&logo.ClubName,
@@ -565,14 +622,21 @@ func listLogos(c *gin.Context) {
 			&hasSVG,
 			&hasPNG,
 			&logo.PrimaryFormat,
+			&aliases,
+			&palette,
+			&clubColors,
 			&logo.CreatedAt,
 			&logo.UpdatedAt,
+			&key,
 		); err != nil {
+			log.Printf("Failed to read logo row: %v", err)
 			continue
 		}
-
 		logo.HasSVG = hasSVG == 1
 		logo.HasPNG = hasPNG == 1
+		logo.Aliases = parseAliases(aliases.String)
+		logo.Palette = decodePalette(palette)
+		logo.ClubColors = parseClubColors(clubColors.String)
 		if logo.HasPNG {
 			logo.LogoURL = fmt.Sprintf("%s/logos/%s?format=png", baseURL, logo.ID)
 		} else if logo.HasSVG {
@@ -580,73 +644,24 @@ func listLogos(c *gin.Context) {
 		}
 
 		logos = append(logos, logo)
+		keys = append(keys, key.String)
 	}
 
-	if q != "" && len(logos) == 0 {
-		limitClause2 := ""
-		args2 := []interface{}{}
-		if limitStr != "" {
-			if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 {
-				limitClause2 = " LIMIT ?"
-				args2 = append(args2, limit)
-				if pageStr != "" {
-					if page, err := strconv.Atoi(pageStr); err == nil {
-						if page < 1 {
-							page = 1
-						}
-						offset := (page - 1) * limit
-						limitClause2 += " OFFSET ?"
-						args2 = append(args2, offset)
-					}
-				}
-			}
-		}
-		where2 := ""
-		if typeParam == "football" || typeParam == "futsal" {
-			where2 = " WHERE LOWER(club_type) = ?"
-			args2 = append(args2, typeParam)
-		}
-		q2 := base + where2 + order + limitClause2
-		rows2, err2 := db.Query(q2, args2...)
-		if err2 == nil {
-			defer rows2.Close()
-			normQ := removeDiacritics(strings.ToLower(q))
-			tmp := []LogoMetadata{}
-			for rows2.Next() {
-				var logo LogoMetadata
-				var hasSVG2, hasPNG2 int
-				if err := rows2.Scan(
-					&logo.ID,
-					&logo.ClubName,
-					&logo.ClubCity,
-					&logo.ClubType,
-					&logo.ClubWebsite,
-					&hasSVG2,
-					&hasPNG2,
-					&logo.PrimaryFormat,
-					&logo.CreatedAt,
-					&logo.UpdatedAt,
-				); err != nil {
-					continue
-				}
-				logo.HasSVG = hasSVG2 == 1
-				logo.HasPNG = hasPNG2 == 1
-				if logo.HasPNG {
-					logo.LogoURL = fmt.Sprintf("%s/logos/%s?format=png", baseURL, logo.ID)
-				} else if logo.HasSVG {
-					logo.LogoURL = fmt.Sprintf("%s/logos/%s?format=svg", baseURL, logo.ID)
-				}
-				nameN := removeDiacritics(strings.ToLower(logo.ClubName))
-				cityN := removeDiacritics(strings.ToLower(logo.ClubCity))
-				if strings.Contains(nameN, normQ) || strings.Contains(cityN, normQ) || strings.Contains(strings.ToLower(logo.ID), strings.ToLower(q)) {
-					tmp = append(tmp, logo)
-				}
-			}
-			logos = tmp
+	// One row more than the limit was fetched to tell whether a next page exists
+	page := LogoPage{Items: logos, Total: total, Limit: limit}
+	if len(logos) > limit {
+		page.Items = logos[:limit]
+		next := listCursor{Sort: sortParam}
+		if sortParam == "relevance" {
+			next.Offset = offset + limit
+		} else {
+			next.Key, next.ID = keys[limit-1], logos[limit-1].ID
 		}
+		page.NextCursor = next.encode()
 	}
 
-	c.JSON(http.StatusOK, logos)
+	setPageLinks(c, page.NextCursor)
+	c.JSON(http.StatusOK, page)
 }
 
 func deleteLogo(c *gin.Context) {
@@ -665,15 +680,24 @@ func deleteLogo(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
 		return
 	}
+	if err := unindexLogo(id); err != nil {
+		log.Printf("Warning: Failed to remove %s from the search index: %v", id, err)
+	}
+	if err := indexLogoColors(id); err != nil {
+		log.Printf("Warning: Failed to remove the colours of %s: %v", id, err)
+	}
 
-	pngPath := filepath.Join("./logos/png", id+".png")
-	svgPath := filepath.Join("./logos/svg", id+".svg")
-	os.Remove(pngPath)
-	os.Remove(svgPath)
+	ctx := c.Request.Context()
+	store.Delete(ctx, logoKey("png", id))
+	store.Delete(ctx, logoKey("svg", id))
+	clearLogoVariants(ctx, id)
+	clearDerivedLogos(ctx, id)
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "id": id})
 }
 
+// uploadLogo accepts a logo file and queues its conversion. It answers 202
+// with the job, whose status is available at GET /jobs/:id.
 func uploadLogo(c *gin.Context) {
 	id := c.Param("id")
 	if id == "" {
@@ -687,73 +711,390 @@ func uploadLogo(c *gin.Context) {
 		return
 	}
 
-	// Read metadata from form
-	clubName := c.PostForm("club_name")
-	clubCity := c.PostForm("club_city")
-	clubType := c.PostForm("club_type")
-	clubWebsite := c.PostForm("club_website")
-
-	if clubName == "" {
-		if club, err := fetchClubByID(id); err == nil && club != nil {
-			if club.Name != "" {
-				clubName = club.Name
-			}
-			if clubType == "" && club.Type != "" {
-				clubType = club.Type
-			}
-			if clubCity == "" && club.City != "" {
-				clubCity = club.City
-			}
-			if clubWebsite == "" && club.Website != "" {
-				clubWebsite = club.Website
-			}
+	form, ok := readLogoUploadForm(c, id)
+	if !ok {
+		return
+	}
+	payload := logoJobPayload{Form: *form}
+	// Attribute the upload to the API key that made it
+	if key := currentAPIKey(c); key != nil {
+		payload.UploadedBy = key.Name
+		payload.APIKeyID = key.ID
+	}
+	if aliases, ok := c.GetPostForm("club_aliases"); ok {
+		payload.Aliases = &aliases
+	}
+
+	job, ok := queueLogoJob(c, JobKindLogoUpload, &payload)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":    true,
+		"id":         id,
+		"job":        job,
+		"status_url": jobStatusURL(c, job.ID),
+		"message":    "logo upload queued for processing",
+	})
+}
+
+// runLogoUploadJob converts an uploaded logo and publishes it as a new
+// revision
+func runLogoUploadJob(ctx context.Context, job *Job, lastAttempt bool) (interface{}, error) {
+	var payload logoJobPayload
+	if err := json.Unmarshal(job.payload, &payload); err != nil {
+		return nil, permanent(err)
+	}
+	data, _, err := readObject(ctx, payload.InputKey)
+	if err != nil {
+		return nil, fmt.Errorf("read upload: %w", err)
+	}
+	// Bulk uploads leave the club lookup to the job
+	if payload.Form.ClubName == "" {
+		club, _ := fetchClubByID(ctx, payload.Form.LogoID)
+		payload.Form.fillFromClub(club)
+	}
+	return publishLogoUpload(ctx, &payload, data, lastAttempt)
+}
+
+// publishLogoUpload converts an uploaded file and stores it as the logo's
+// new current revision, returning the job result
+func publishLogoUpload(ctx context.Context, payload *logoJobPayload, data []byte, lastAttempt bool) (gin.H, error) {
+	// Conversions run on local files in a scratch directory; the results
+	// are copied to the configured storage afterwards
+	workDir, err := os.MkdirTemp("", "logo-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	// Keep the upload as an immutable revision and make it current
+	upload, err := processLogoUpload(payload.Form, data, workDir, lastAttempt)
+	if err != nil {
+		return nil, err
+	}
+	rev := upload.Rev
+	rev.UploadedBy = payload.UploadedBy
+	rev.APIKeyID = payload.APIKeyID
+	if err := commitLogoRevision(ctx, rev, upload.SVGPath, upload.SVGOriginalPath, upload.PNGPath, upload.SourcePath); err != nil {
+		return nil, fmt.Errorf("save logo: %w", err)
+	}
+
+	// Alternative names are searchable but not part of the revision
+	id := payload.Form.LogoID
+	if payload.Aliases != nil {
+		if _, err := db.Exec("UPDATE logos SET club_aliases = ? WHERE id = ?", nullString(strings.Join(parseAliases(*payload.Aliases), "\n")), id); err != nil {
+			log.Printf("Failed to save aliases of %s: %v", id, err)
+		} else if err := indexLogo(id); err != nil {
+			log.Printf("Warning: Failed to index logo %s: %v", id, err)
 		}
-		if clubName == "" {
-			clubName = "Club " + id
+	}
+
+	result := gin.H{
+		"id":        id,
+		"club_name": rev.ClubName,
+		"has_svg":   rev.HasSVG,
+		"has_png":   rev.HasPNG,
+		"size_svg":  rev.FileSizeSVG,
+		"size_png":  rev.FileSizePNG,
+		"revision":  rev.Revision,
+	}
+	if rev.FileSizeSVGOriginal > 0 {
+		result["size_svg_original"] = rev.FileSizeSVGOriginal
+	}
+	if rev.SourceFormat != "" {
+		result["source_format"] = rev.SourceFormat
+		result["size_source"] = rev.FileSizeSource
+	}
+	if rev.BackgroundRemoved {
+		result["background_removed"] = true
+	}
+	if rev.Bounds != nil {
+		result["bbox"] = rev.Bounds
+		result["aspect_ratio"] = rev.AspectRatio
+	}
+	if len(rev.Palette) > 0 {
+		result["palette"] = rev.Palette
+	}
+	if upload.Sanitized != nil {
+		result["sanitized"] = upload.Sanitized
+	}
+	if len(upload.Duplicates) > 0 {
+		result["duplicates"] = upload.Duplicates
+	}
+	if len(upload.Warnings) > 0 {
+		result["warnings"] = upload.Warnings
+	}
+	return result, nil
+}
+
+// logoUploadForm is an upload as received: the club metadata and the
+// extension matching the uploaded file's detected format
+type logoUploadForm struct {
+	LogoID      string `json:"logo_id"`
+	ClubName    string `json:"club_name"`
+	ClubCity    string `json:"club_city,omitempty"`
+	ClubType    string `json:"club_type,omitempty"`
+	ClubWebsite string `json:"club_website,omitempty"`
+	Ext         string `json:"ext"`
+
+	// Options for raster uploads
+	RemoveBackground    bool `json:"remove_background,omitempty"`
+	BackgroundTolerance int  `json:"background_tolerance,omitempty"`
+
+	// Padding around the normalized PNG in percent, nil for LOGO_PADDING
+	Padding *int `json:"padding,omitempty"`
+}
+
+// logoJobPayload is what upload and submission jobs need to process a file
+// stored at InputKey, or for imports, downloaded from SourceURL
+type logoJobPayload struct {
+	Form           logoUploadForm `json:"form"`
+	InputKey       string         `json:"input_key"`
+	UploadedBy     string         `json:"uploaded_by,omitempty"`
+	APIKeyID       string         `json:"api_key_id,omitempty"`
+	Aliases        *string        `json:"aliases,omitempty"`
+	SourceURL      string         `json:"source_url,omitempty"`
+	SubmitterName  string         `json:"submitter_name,omitempty"`
+	SubmitterEmail string         `json:"submitter_email,omitempty"`
+	SubmitterIP    string         `json:"submitter_ip,omitempty"`
+}
+
+// logoUpload is a processed upload: the revision to store (not yet saved) and
+// the local master files it was built from. SVGOriginalPath is the sanitized
+// SVG before optimization, empty when there is no SVG; SourcePath is the
+// uploaded raster file when the PNG master differs from it. Duplicates are
+// other clubs' logos that look the same.
+type logoUpload struct {
+	Rev             *LogoRevision
+	SVGPath         string
+	SVGOriginalPath string
+	PNGPath         string
+	SourcePath      string
+	Sanitized       *SVGSanitizeReport
+	Duplicates      []SimilarLogo
+	Warnings        []string
+}
+
+// fillFromClub completes missing metadata from the club's FAČR page, which
+// may be nil when the club could not be fetched
+func (form *logoUploadForm) fillFromClub(club *Club) {
+	if club != nil {
+		if form.ClubName == "" && club.Name != "" {
+			form.ClubName = club.Name
+		}
+		if form.ClubType == "" && club.Type != "" {
+			form.ClubType = club.Type
 		}
+		if form.ClubCity == "" && club.City != "" {
+			form.ClubCity = club.City
+		}
+		if form.ClubWebsite == "" && club.Website != "" {
+			form.ClubWebsite = club.Website
+		}
+	}
+	if form.ClubName == "" {
+		form.ClubName = "Club " + form.LogoID
+	}
+}
+
+// readOptions reads the processing options of an upload form
+// (remove_background, background_tolerance, padding)
+func (form *logoUploadForm) readOptions(c *gin.Context) error {
+	form.RemoveBackground = c.PostForm("remove_background") == "true"
+	tolerance, err := parseBackgroundTolerance(c.PostForm("background_tolerance"))
+	if err != nil {
+		return err
+	}
+	form.BackgroundTolerance = tolerance
+	form.Padding, err = parseLogoPadding(c.PostForm("padding"))
+	return err
+}
+
+// readLogoUploadForm reads the club metadata from the form and checks the
+// uploaded file's type. On failure an error response has already been
+// written.
+func readLogoUploadForm(c *gin.Context, id string) (*logoUploadForm, bool) {
+	// Read metadata from form
+	form := &logoUploadForm{
+		LogoID:      id,
+		ClubName:    c.PostForm("club_name"),
+		ClubCity:    c.PostForm("club_city"),
+		ClubType:    c.PostForm("club_type"),
+		ClubWebsite: c.PostForm("club_website"),
+	}
+
+	// Anonymous submitters get the local directory only, never an upstream
+	// lookup
+	if form.ClubName == "" {
+		if currentAPIKey(c) != nil {
+			club, _ := fetchClubByID(c.Request.Context(), id)
+			form.fillFromClub(club)
+		} else if club, err := lookupDirectoryClub(id); err == nil {
+			form.fillFromClub(club)
+		}
+	}
+
+	if err := form.readOptions(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
 	}
 
 	// Get uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
-		return
+		return nil, false
 	}
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	if ext != ".svg" && ext != ".png" && ext != ".pdf" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "only .svg, .png and .pdf files are allowed"})
-		return
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return nil, false
 	}
+	defer f.Close()
+
+	// The type comes from the content; names like "logo_crop.jpg.png" lie
+	head := make([]byte, 4096)
+	n, _ := io.ReadFull(f, head)
+	ext, ok := uploadExtensions[DetectImageFormat(head[:n])]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported file type, expected SVG, PNG, PDF, JPEG, WebP or GIF"})
+		return nil, false
+	}
+	form.Ext = ext
+	return form, true
+}
 
-	// Determine storage paths
-	var svgPath, pngPath string
+// uploadExtensions maps the accepted detected formats to the extension used
+// for the uploaded file while it is processed
+var uploadExtensions = map[string]string{
+	"svg":  ".svg",
+	"png":  ".png",
+	"pdf":  ".pdf",
+	"jpeg": ".jpg",
+	"webp": ".webp",
+	"gif":  ".gif",
+}
+
+// queueLogoJob stores the uploaded file as the input of a new job of the
+// given kind. On failure an error response has already been written.
+func queueLogoJob(c *gin.Context, kind string, payload *logoJobPayload) (*Job, bool) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return nil, false
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return nil, false
+	}
+	defer f.Close()
+
+	jobID := uuid.NewString()
+	payload.InputKey = jobInputKey(jobID, "upload"+payload.Form.Ext)
+	if err := store.Put(c.Request.Context(), payload.InputKey, f, file.Size, ""); err != nil {
+		log.Printf("Failed to store upload for job %s: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save upload"})
+		return nil, false
+	}
+
+	job, err := enqueueJob(jobID, kind, payload.Form.LogoID, payload)
+	if err != nil {
+		store.Delete(c.Request.Context(), payload.InputKey)
+		log.Printf("Failed to queue job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
+	}
+	return job, true
+}
+
+// processLogoUpload sanitizes, optimizes and converts an uploaded file into
+// SVG/PNG masters inside workDir; JPEG, WebP and GIF become a PNG master, and
+// raster uploads may have their background removed. Invalid uploads fail
+// permanently. A failed SVG to PNG conversion is retried; on the last
+// attempt the logo is kept SVG-only and the failure reported as a warning.
+func processLogoUpload(form logoUploadForm, data []byte, workDir string, lastAttempt bool) (*logoUpload, error) {
+	id, clubName, ext := form.LogoID, form.ClubName, form.Ext
+
+	// Determine working paths
+	svgPath := filepath.Join(workDir, id+".svg")
+	pngPath := filepath.Join(workDir, id+".png")
+	inputPath := filepath.Join(workDir, id+ext)
+	var svgOriginalPath, sourcePath, sourceFormat string
 	var hasSVG, hasPNG int
-	var sizeSVG, sizePNG int64
+	var sizeSVG, sizePNG, sizeSVGOriginal, sizeSource int64
+	var backgroundRemoved bool
+	var norm logoNormalization
+	var sanitized *SVGSanitizeReport
+	var warnings []string
+
+	var err error
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return nil, err
+	}
 
-	if ext == ".svg" || ext == ".pdf" {
-		pngPath = filepath.Join("./logos/png", id+".png")
+	// Trim the PNG master and centre it on a square canvas
+	padding := logoPadding()
+	if form.Padding != nil {
+		padding = *form.Padding
+	}
+	normalize := func(size int) error {
+		if norm, err = normalizeLogoFile(pngPath, size, padding); err != nil {
+			return fmt.Errorf("normalize PNG: %w", err)
+		}
+		if norm.Bounds == nil {
+			warnings = append(warnings, "the PNG has no visible pixels, it was kept as is")
+		}
+		return nil
+	}
 
+	if ext == ".svg" || ext == ".pdf" {
+		if form.RemoveBackground {
+			warnings = append(warnings, "background removal applies to raster uploads only")
+		}
 		if ext == ".svg" {
-			svgPath = filepath.Join("./logos/svg", id+".svg")
 
-			// Save SVG
-			if err := c.SaveUploadedFile(file, svgPath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save SVG file"})
-				return
+			// SVGs are served as-is to browsers, strip anything executable
+			if sanitized, err = sanitizeSVGFile(svgPath); err != nil {
+				return nil, permanent(fmt.Errorf("invalid SVG: %w", err))
+			}
+			if len(sanitized.Removed) > 0 {
+				log.Printf("Sanitized SVG for club %s: %s", clubName, strings.Join(sanitized.Removed, "; "))
+			}
+
+			// Serve a minified SVG, keeping the sanitized upload as the original
+			svgOriginalPath = filepath.Join(workDir, id+".original.svg")
+			if err := optimizeSVGFile(svgPath, svgOriginalPath); err != nil {
+				log.Printf("Warning: Failed to optimize SVG: %v", err)
 			}
 
-			// Get SVG file size
+			// Get SVG file sizes
 			if stat, err := os.Stat(svgPath); err == nil {
 				sizeSVG = stat.Size()
 			}
+			if stat, err := os.Stat(svgOriginalPath); err == nil {
+				sizeSVGOriginal = stat.Size()
+			} else {
+				svgOriginalPath = ""
+			}
 			hasSVG = 1
 
 			// Convert SVG to PNG
 			log.Printf("Converting SVG to PNG for club: %s", clubName)
-			if err := ConvertSVGToPNG(svgPath, pngPath, 512); err != nil {
+			renderToFile := func(out string, width int) error { return ConvertSVGToPNG(svgPath, out, width) }
+			if err := renderVectorLogo(renderToFile, pngPath, padding); err != nil {
+				if !lastAttempt {
+					return nil, fmt.Errorf("convert SVG to PNG: %w", err)
+				}
+				// Keep the SVG rather than losing the upload
 				log.Printf("Warning: Failed to convert SVG to PNG: %v", err)
-				// Don't fail the upload, just log the warning
+				warnings = append(warnings, "SVG to PNG conversion failed, the logo is available as SVG only: "+err.Error())
 			} else {
+				if err := normalize(logoCanvasSize); err != nil {
+					return nil, err
+				}
 				// Optimize PNG
 				if err := OptimizePNG(pngPath); err != nil {
 					log.Printf("Warning: Failed to optimize PNG: %v", err)
@@ -766,24 +1107,14 @@ func uploadLogo(c *gin.Context) {
 			}
 		} else {
 			// PDF file - convert directly to PNG
-			pdfTempPath := filepath.Join("./logos/temp", id+".pdf")
-			os.MkdirAll("./logos/temp", 0755)
-
-			if err := c.SaveUploadedFile(file, pdfTempPath); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save PDF file"})
-				return
-			}
-
 			log.Printf("Converting PDF to PNG for club: %s", clubName)
-			if err := ConvertPDFToPNG(pdfTempPath, pngPath, 512); err != nil {
-				log.Printf("Error: Failed to convert PDF to PNG: %v", err)
-				os.Remove(pdfTempPath)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to convert PDF to PNG"})
-				return
+			renderToFile := func(out string, width int) error { return ConvertPDFToPNG(inputPath, out, width) }
+			if err := renderVectorLogo(renderToFile, pngPath, padding); err != nil {
+				return nil, fmt.Errorf("convert PDF to PNG: %w", err)
+			}
+			if err := normalize(logoCanvasSize); err != nil {
+				return nil, err
 			}
-
-			// Clean up temp PDF
-			os.Remove(pdfTempPath)
 
 			// Optimize PNG
 			if err := OptimizePNG(pngPath); err != nil {
@@ -798,12 +1129,43 @@ func uploadLogo(c *gin.Context) {
 		}
 
 	} else {
-		// PNG upload
-		pngPath = filepath.Join("./logos/png", id+".png")
+		// Raster upload: a PNG is the master as-is, JPEG, WebP and GIF are
+		// decoded into a PNG master and kept as the source
+		format, err := ValidateImageFile(inputPath)
+		if err != nil {
+			return nil, permanent(err)
+		}
+		if format != "png" {
+			log.Printf("Converting %s to PNG for club: %s", strings.ToUpper(format), clubName)
+			if err := ConvertRasterToPNG(inputPath, pngPath); err != nil {
+				return nil, permanent(fmt.Errorf("convert %s to PNG: %w", format, err))
+			}
+			sourcePath, sourceFormat, sizeSource = inputPath, format, int64(len(data))
+		}
 
-		if err := c.SaveUploadedFile(file, pngPath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save PNG file"})
-			return
+		if form.RemoveBackground {
+			removed, err := removeBackgroundFile(pngPath, form.BackgroundTolerance)
+			if err != nil {
+				return nil, permanent(fmt.Errorf("remove background: %w", err))
+			}
+			if !removed {
+				warnings = append(warnings, "no uniform background found, the image was kept as uploaded")
+			}
+			backgroundRemoved = removed
+		}
+
+		// Raster masters keep their resolution
+		if err := normalize(0); err != nil {
+			return nil, permanent(err)
+		}
+
+		// An uploaded PNG that was changed is kept as the source
+		if sourcePath == "" && (backgroundRemoved || norm.Changed) {
+			sourcePath = filepath.Join(workDir, id+".source.png")
+			if err := os.WriteFile(sourcePath, data, 0644); err != nil {
+				return nil, err
+			}
+			sourceFormat, sizeSource = format, int64(len(data))
 		}
 
 		// Optimize PNG
@@ -818,31 +1180,49 @@ func uploadLogo(c *gin.Context) {
 		hasPNG = 1
 	}
 
-	// Save metadata to database
-	_, err = db.Exec(`
-		INSERT OR REPLACE INTO logos (
-			id, club_name, club_city, club_type, club_website,
-			has_svg, has_png, primary_format,
-			file_size_svg, file_size_png, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, 'png', ?, ?, CURRENT_TIMESTAMP)
-	`, id, clubName, clubCity, clubType, clubWebsite, hasSVG, hasPNG, sizeSVG, sizePNG)
-
-	if err != nil {
-		log.Printf("Database error: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save metadata"})
-		return
+	// Dominant colours and perceptual hash of the final PNG
+	var palette []PaletteColor
+	var phash string
+	var duplicates []SimilarLogo
+	if hasPNG == 1 {
+		if img, err := decodeImageFile(pngPath); err != nil {
+			log.Printf("Warning: Failed to analyse the PNG: %v", err)
+		} else {
+			palette, phash = ExtractPalette(img), PerceptualHash(img)
+			// The same crest under another club ID is most likely a mistake
+			if duplicates, err = findSimilarLogos(phash, id, duplicateHashDistance, maxDuplicateWarnings); err != nil {
+				log.Printf("Warning: Failed to look for duplicates: %v", err)
+			}
+			warnings = append(warnings, duplicateWarnings(duplicates)...)
+		}
 	}
 
-	response := gin.H{
-		"success":   true,
-		"id":        id,
-		"club_name": clubName,
-		"has_svg":   hasSVG == 1,
-		"has_png":   hasPNG == 1,
-		"size_svg":  sizeSVG,
-		"size_png":  sizePNG,
-		"message":   "logo uploaded successfully",
+	rev := &LogoRevision{
+		LogoID:              id,
+		ClubName:            clubName,
+		ClubCity:            form.ClubCity,
+		ClubType:            form.ClubType,
+		ClubWebsite:         form.ClubWebsite,
+		HasSVG:              hasSVG == 1,
+		HasPNG:              hasPNG == 1,
+		FileSizeSVG:         sizeSVG,
+		FileSizePNG:         sizePNG,
+		FileSizeSVGOriginal: sizeSVGOriginal,
+		SourceFormat:        sourceFormat,
+		FileSizeSource:      sizeSource,
+		BackgroundRemoved:   backgroundRemoved,
+		Bounds:              norm.Bounds,
+		AspectRatio:         norm.AspectRatio,
+		Palette:             palette,
+		PHash:               phash,
+	}
+	// Content hashes back the ETags and immutable URLs
+	if rev.HasSVG {
+		rev.HashSVG, _ = hashFile(svgPath)
+	}
+	if rev.HasPNG {
+		rev.HashPNG, _ = hashFile(pngPath)
 	}
 
-	c.JSON(http.StatusOK, response)
+	return &logoUpload{Rev: rev, SVGPath: svgPath, SVGOriginalPath: svgOriginalPath, PNGPath: pngPath, SourcePath: sourcePath, Sanitized: sanitized, Duplicates: duplicates, Warnings: warnings}, nil
 }
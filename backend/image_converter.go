@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/gif"
+	_ "image/jpeg"
 	"image/png"
 	"io"
+	"math"
+	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 
 	"github.com/srwiley/oksvg"
 	"github.com/srwiley/rasterx"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
 )
 
 // ConvertSVGToPNG converts an SVG file to PNG format
@@ -101,28 +107,41 @@ func convertWithGoRenderer(svgPath, pngPath string, width int) error {
 	}
 	defer f.Close()
 
-	icon, err := oksvg.ReadIconStream(f)
+	rgba, err := renderSVG(f, width, 0)
 	if err != nil {
-		return fmt.Errorf("parse svg: %w", err)
+		return err
 	}
 
-	vb := icon.ViewBox
-	targetW := width
-	if targetW <= 0 {
-		targetW = int(vb.W)
-		if targetW <= 0 {
-			targetW = 512
-		}
+	out, err := os.Create(pngPath)
+	if err != nil {
+		return fmt.Errorf("create png: %w", err)
+	}
+	defer out.Close()
+
+	if err := png.Encode(out, rgba); err != nil {
+		os.Remove(pngPath)
+		return fmt.Errorf("encode png: %w", err)
 	}
-	var targetH int
-	if vb.W != 0 {
-		targetH = int(float64(targetW) * (vb.H / vb.W))
-	} else {
-		targetH = targetW
+	return nil
+}
+
+// renderSVG rasterizes an SVG so that it fits into a width x height box while
+// keeping the viewBox aspect ratio. A zero dimension is derived from the other
+// one; when both are zero the viewBox width (or 512px) is used.
+func renderSVG(r io.Reader, width, height int) (*image.RGBA, error) {
+	icon, err := oksvg.ReadIconStream(r)
+	if err != nil {
+		return nil, fmt.Errorf("parse svg: %w", err)
 	}
-	if targetH <= 0 {
-		targetH = targetW
+
+	vb := icon.ViewBox
+	if width <= 0 && height <= 0 {
+		width = int(vb.W)
+		if width <= 0 {
+			width = 512
+		}
 	}
+	targetW, targetH := fitDimensions(vb.W, vb.H, width, height)
 
 	icon.SetTarget(0, 0, float64(targetW), float64(targetH))
 
@@ -131,15 +150,82 @@ func convertWithGoRenderer(svgPath, pngPath string, width int) error {
 	raster := rasterx.NewDasher(targetW, targetH, scanner)
 	icon.Draw(raster, 1.0)
 
-	out, err := os.Create(pngPath)
-	if err != nil {
-		return fmt.Errorf("create png: %w", err)
+	return rgba, nil
+}
+
+// fitDimensions scales srcW x srcH to fit into a width x height box. A zero
+// box dimension leaves that side unconstrained. Sources without a usable size
+// are treated as square.
+func fitDimensions(srcW, srcH float64, width, height int) (int, int) {
+	if srcW <= 0 || srcH <= 0 {
+		srcW, srcH = 1, 1
 	}
-	defer out.Close()
+	var scale float64
+	switch {
+	case width > 0 && height > 0:
+		scale = math.Min(float64(width)/srcW, float64(height)/srcH)
+	case width > 0:
+		scale = float64(width) / srcW
+	default:
+		scale = float64(height) / srcH
+	}
+	w := int(math.Round(srcW * scale))
+	h := int(math.Round(srcH * scale))
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
 
-	if err := png.Encode(out, rgba); err != nil {
-		os.Remove(pngPath)
-		return fmt.Errorf("encode png: %w", err)
+// ResizeImage resamples img so that it fits into a width x height box
+// (see fitDimensions) using Catmull-Rom interpolation.
+func ResizeImage(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	w, h := fitDimensions(float64(b.Dx()), float64(b.Dy()), width, height)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Src, nil)
+	return dst
+}
+
+// ConvertPNGToWebP converts a PNG file to lossless WebP
+// Uses cwebp if available, otherwise falls back to ImageMagick
+func ConvertPNGToWebP(pngPath, webpPath string) error {
+	cmd := exec.Command("cwebp", "-quiet", "-lossless", "-m", "6", pngPath, "-o", webpPath)
+	if err := runConverter(cmd, "cwebp"); err == nil {
+		return nil
+	}
+
+	cmd = exec.Command("convert", pngPath, "-define", "webp:lossless=true", webpPath)
+	if err := runConverter(cmd, "imagemagick"); err != nil {
+		return fmt.Errorf("no WebP encoder available (install libwebp or ImageMagick): %w", err)
+	}
+	return nil
+}
+
+// ConvertPNGToAVIF converts a PNG file to AVIF
+// Uses avifenc if available, otherwise falls back to ImageMagick
+func ConvertPNGToAVIF(pngPath, avifPath string) error {
+	cmd := exec.Command("avifenc", "--speed", "6", pngPath, avifPath)
+	if err := runConverter(cmd, "avifenc"); err == nil {
+		return nil
+	}
+
+	cmd = exec.Command("convert", pngPath, "-quality", "80", avifPath)
+	if err := runConverter(cmd, "imagemagick"); err != nil {
+		return fmt.Errorf("no AVIF encoder available (install libavif or ImageMagick): %w", err)
+	}
+	return nil
+}
+
+func runConverter(cmd *exec.Cmd, name string) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s conversion failed: %v - %s", name, err, stderr.String())
 	}
 	return nil
 }
@@ -199,34 +285,143 @@ func IsSVGFile(file io.Reader) (bool, error) {
 		bytes.Contains([]byte(content), []byte("<?xml")), nil
 }
 
-// ValidateImageFile validates that a file is a valid SVG or PNG
+// DetectImageFormat identifies an image by its content: "svg", "png", "pdf",
+// "jpeg", "gif" or "webp", or "" when the format is not recognized
+func DetectImageFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "webp"
+	}
+
+	// SVG is XML text starting with a prolog, comment or the <svg> element
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<svg")) {
+		return "svg"
+	}
+	return ""
+}
+
+// ValidateImageFile checks that a file is an image this service accepts,
+// identified by its content rather than its extension, and returns its
+// format (see DetectImageFormat). Raster images must decode.
 func ValidateImageFile(filePath string) (string, error) {
-	ext := filepath.Ext(filePath)
-	
-	file, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
 
-	if ext == ".svg" {
-		isSVG, err := IsSVGFile(file)
+	format := DetectImageFormat(data)
+	switch format {
+	case "svg":
+		isSVG, err := IsSVGFile(bytes.NewReader(data))
 		if err != nil {
 			return "", err
 		}
 		if !isSVG {
 			return "", fmt.Errorf("file is not a valid SVG")
 		}
-		return "svg", nil
+	case "pdf":
+	case "png", "jpeg", "gif", "webp":
+		if err := checkRasterImage(data, format); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported file format %s", http.DetectContentType(data))
 	}
+	return format, nil
+}
+
+// Largest raster upload accepted, in pixels, so small files cannot expand
+// into huge images when decoded
+const maxRasterPixels = 50_000_000
+
+// rasterSourceFormats are uploaded raster formats kept alongside the PNG
+// master as its source: JPEG, WebP and GIF are always decoded into a new
+// master, a PNG only when it was modified (background removal, trimming)
+var rasterSourceFormats = map[string]struct{ Ext, ContentType string }{
+	"png":  {".png", "image/png"},
+	"jpeg": {".jpg", "image/jpeg"},
+	"webp": {".webp", "image/webp"},
+	"gif":  {".gif", "image/gif"},
+}
 
-	if ext == ".png" {
-		_, err := png.Decode(file)
+// checkRasterImage verifies that data decodes as a single image of the given
+// format within maxRasterPixels
+func checkRasterImage(data []byte, format string) error {
+	return checkRasterImageSize(data, format, maxRasterPixels)
+}
+
+// checkRasterImageSize is checkRasterImage with a smaller pixel limit
+func checkRasterImageSize(data []byte, format string, maxPixels int) error {
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return fmt.Errorf("file is not a valid %s image: %v", strings.ToUpper(format), err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return fmt.Errorf("image dimensions %dx%d are not supported", cfg.Width, cfg.Height)
+	}
+	if format == "gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
 		if err != nil {
-			return "", fmt.Errorf("file is not a valid PNG: %v", err)
+			return fmt.Errorf("file is not a valid GIF image: %v", err)
+		}
+		if len(anim.Image) > 1 {
+			return fmt.Errorf("animated GIFs are not supported")
 		}
-		return "png", nil
+	}
+	return nil
+}
+
+// ConvertRasterToPNG decodes a JPEG, WebP, static GIF (or PNG) file and
+// writes it as a PNG
+func ConvertRasterToPNG(srcPath, pngPath string) error {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+	format := DetectImageFormat(data)
+	if _, ok := rasterSourceFormats[format]; !ok {
+		return fmt.Errorf("unsupported raster format %q", format)
+	}
+	if err := checkRasterImage(data, format); err != nil {
+		return err
 	}
 
-	return "", fmt.Errorf("unsupported file format: %s", ext)
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(pngPath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(out, img); err != nil {
+		out.Close()
+		os.Remove(pngPath)
+		return err
+	}
+	return out.Close()
+}
+
+// decodeImageFile decodes a PNG (or other registered raster format) file
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job kinds
+const (
+	JobKindLogoUpload     = "logo_upload"
+	JobKindLogoSubmission = "logo_submission"
+	JobKindLogoImport     = "logo_import"
+	JobKindClubSync       = "club_sync"
+)
+
+// Attempts per job before it is marked failed
+const maxJobAttempts = 3
+
+// How often idle workers look for due jobs (retries become due over time)
+const jobPollInterval = 2 * time.Second
+
+// Job is a unit of background work, such as converting an uploaded logo.
+// Jobs are persisted in the jobs table, so unfinished ones survive restarts.
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	LogoID      string          `json:"logo_id,omitempty"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Error       string          `json:"error,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+
+	payload []byte
+}
+
+// jobHandler runs one attempt of a job and returns its result. lastAttempt
+// is set when a failure would not be retried.
+type jobHandler func(ctx context.Context, job *Job, lastAttempt bool) (interface{}, error)
+
+// jobHandlers maps job kinds to the functions that run them
+var jobHandlers = map[string]jobHandler{
+	JobKindLogoUpload:     runLogoUploadJob,
+	JobKindLogoSubmission: runSubmissionJob,
+	JobKindLogoImport:     runLogoImportJob,
+	JobKindClubSync:       runClubSyncJob,
+}
+
+// jobWake nudges idle workers when a job is enqueued
+var jobWake = make(chan struct{}, 1)
+
+// permanentError marks a job failure that retrying cannot fix, such as an
+// invalid upload
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err}
+}
+
+// jobInputKey returns the storage key of a file a job works on
+func jobInputKey(jobID, name string) string {
+	return fmt.Sprintf("jobs/%s/%s", jobID, name)
+}
+
+const jobColumns = `id, kind, logo_id, status, attempts, max_attempts, error, result, payload,
+	created_at, updated_at, started_at, finished_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	var job Job
+	var jobErr, result sql.NullString
+	var startedAt, finishedAt sql.NullTime
+	if err := row.Scan(
+		&job.ID, &job.Kind, &job.LogoID, &job.Status, &job.Attempts, &job.MaxAttempts, &jobErr, &result, &job.payload,
+		&job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt,
+	); err != nil {
+		return nil, err
+	}
+	job.Error = jobErr.String
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+func loadJob(id string) (*Job, error) {
+	return scanJob(db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+}
+
+// enqueueJob stores a new job of a logo with a JSON payload and wakes a
+// worker. id may be preset so input files can be stored under the job's key
+// first. Jobs of the same logo run one at a time.
+func enqueueJob(id, kind, logoID string, payload interface{}) (*Job, error) {
+	return enqueueLockedJob(id, kind, logoID, logoID, payload)
+}
+
+// enqueueLockedJob is enqueueJob for jobs that may not belong to a logo
+// (logoID ""): jobs sharing a non-empty lockKey run one at a time, in the
+// order they were queued.
+func enqueueLockedJob(id, kind, logoID, lockKey string, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	if _, err := db.Exec(`
+		INSERT INTO jobs (id, kind, logo_id, lock_key, status, max_attempts, payload)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, id, kind, logoID, nullString(lockKey), JobQueued, maxJobAttempts, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case jobWake <- struct{}{}:
+	default:
+	}
+	return loadJob(id)
+}
+
+// recoverJobs requeues jobs that were running when the server stopped.
+// Jobs that had used their last attempt fail instead, so a job that brings
+// the server down cannot do so on every start.
+func recoverJobs() error {
+	res, err := db.Exec(`
+		UPDATE jobs
+		SET status = ?, error = 'interrupted on the last attempt',
+		    finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE status = ? AND attempts >= max_attempts
+	`, JobFailed, JobRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Warning: Failed %d jobs interrupted on their last attempt", n)
+	}
+	res, err = db.Exec("UPDATE jobs SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE status = ?", JobQueued, JobRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("✓ Requeued %d interrupted jobs", n)
+	}
+	return nil
+}
+
+// startJobWorkers starts the worker pool; its size comes from JOB_WORKERS
+// (default 2)
+func startJobWorkers(ctx context.Context) {
+	workers := 2
+	if v, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+	for i := 0; i < workers; i++ {
+		go runJobWorker(ctx)
+	}
+	log.Printf("⚙️  Started %d job workers", workers)
+}
+
+func runJobWorker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := claimJob()
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Failed to claim job: %v", err)
+		}
+		if job != nil {
+			runJob(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-jobWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimJob marks the oldest due job as running and returns it. Jobs wait
+// while another job with their lock key is running or an earlier one is
+// still queued (say waiting for a retry), so uploads of the same logo are
+// applied in order. Jobs are ordered by rowid, as created_at only has whole
+// seconds.
+func claimJob() (*Job, error) {
+	var id string
+	err := db.QueryRow(`
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, error = NULL,
+		    started_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_after <= datetime('now')
+			  AND NOT EXISTS (
+				SELECT 1 FROM jobs other
+				WHERE other.lock_key = jobs.lock_key
+				  AND (other.status = ? OR (other.status = ? AND other.rowid < jobs.rowid))
+			  )
+			ORDER BY rowid
+			LIMIT 1
+		)
+		RETURNING id
+	`, JobRunning, JobQueued, JobRunning, JobQueued).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return loadJob(id)
+}
+
+// runJob runs one attempt of a claimed job and records the outcome. Failed
+// attempts are retried with a growing delay until maxJobAttempts is reached.
+func runJob(ctx context.Context, job *Job) {
+	handler, ok := jobHandlers[job.Kind]
+	if !ok {
+		finishJob(job, JobFailed, nil, fmt.Errorf("unknown job kind %q", job.Kind))
+		return
+	}
+
+	lastAttempt := job.Attempts >= job.MaxAttempts
+	result, err := callJobHandler(ctx, handler, job, lastAttempt)
+	if err == nil {
+		finishJob(job, JobSucceeded, result, nil)
+		return
+	}
+
+	var perm permanentError
+	if lastAttempt || errors.As(err, &perm) {
+		log.Printf("Job %s (%s) failed: %v", job.ID, job.Kind, err)
+		finishJob(job, JobFailed, nil, err)
+		return
+	}
+
+	delay := time.Duration(job.Attempts*job.Attempts) * 5 * time.Second
+	log.Printf("Job %s (%s) attempt %d failed, retrying in %s: %v", job.ID, job.Kind, job.Attempts, delay, err)
+	if _, dbErr := db.Exec(`
+		UPDATE jobs
+		SET status = ?, error = ?, run_after = datetime('now', ?), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, JobQueued, err.Error(), fmt.Sprintf("+%d seconds", int(delay.Seconds())), job.ID); dbErr != nil {
+		log.Printf("Failed to requeue job %s: %v", job.ID, dbErr)
+	}
+}
+
+// callJobHandler runs a job handler, turning a panic (say in an image
+// decoder fed a hostile upload) into a permanent failure of the job
+func callJobHandler(ctx context.Context, handler jobHandler, job *Job, lastAttempt bool) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s (%s) panicked: %v\n%s", job.ID, job.Kind, r, debug.Stack())
+			result, err = nil, permanent(fmt.Errorf("job crashed: %v", r))
+		}
+	}()
+	return handler(ctx, job, lastAttempt)
+}
+
+// finishJob stores the final state of a job and drops its input files
+func finishJob(job *Job, status string, result interface{}, jobErr error) {
+	var resultJSON sql.NullString
+	if result != nil {
+		if data, err := json.Marshal(result); err == nil {
+			resultJSON = sql.NullString{String: string(data), Valid: true}
+		}
+	}
+	var errText sql.NullString
+	if jobErr != nil {
+		errText = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+	if _, err := db.Exec(`
+		UPDATE jobs
+		SET status = ?, result = ?, error = ?, finished_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, status, resultJSON, errText, job.ID); err != nil {
+		log.Printf("Failed to record result of job %s: %v", job.ID, err)
+	}
+
+	ctx := context.Background()
+	if objects, err := store.List(ctx, jobInputKey(job.ID, "")); err == nil {
+		for _, obj := range objects {
+			store.Delete(ctx, obj.Key)
+		}
+	}
+}
+
+// ==================== Job Handlers ====================
+
+// jobStatusURL returns the URL of a job's status endpoint
+func jobStatusURL(c *gin.Context, id string) string {
+	return requestBaseURL(c) + "/jobs/" + id
+}
+
+// getJob returns the status of a background job and, once it succeeded,
+// its result. Contributors see every job, other keys only their own.
+func getJob(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job ID"})
+		return
+	}
+
+	job, err := loadJob(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if key := currentAPIKey(c); roleRanks[key.Role] < roleRanks[RoleContributor] {
+		var owner struct {
+			APIKeyID string `json:"api_key_id"`
+		}
+		json.Unmarshal(job.payload, &owner)
+		if owner.APIKeyID != key.ID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Palette extraction
+const (
+	maxPaletteColors  = 6
+	minPaletteWeight  = 0.02 // share of the visible pixels
+	paletteMergeDelta = 12   // CIE76 distance below which colours are merged
+	maxPaletteSamples = 1 << 16
+	paletteMatchDelta = 50 // CIE76 distance at which colours stop matching
+)
+
+// Colour filter of GET /logos: a logo matches when one of its colours with
+// at least minColorFilterWeight is within color_distance (CIE76) of the query
+const (
+	defaultColorDistance = 20
+	maxColorDistance     = 100
+	minColorFilterWeight = 0.05
+	maxClubColors        = maxPaletteColors
+)
+
+// PaletteColor is a dominant colour of a logo and its share of the visible
+// pixels
+type PaletteColor struct {
+	Hex    string  `json:"hex"`
+	Weight float64 `json:"weight"`
+}
+
+// labColor is a colour in CIE L*a*b* (D65)
+type labColor struct{ L, A, B float64 }
+
+// toLab converts an sRGB colour to CIE L*a*b*
+func toLab(c color.NRGBA) labColor {
+	linear := func(v uint8) float64 {
+		f := float64(v) / 255
+		if f <= 0.04045 {
+			return f / 12.92
+		}
+		return math.Pow((f+0.055)/1.055, 2.4)
+	}
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return labColor{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// distance is the CIE76 colour difference
+func (c labColor) distance(o labColor) float64 {
+	return math.Sqrt((c.L-o.L)*(c.L-o.L) + (c.A-o.A)*(c.A-o.A) + (c.B-o.B)*(c.B-o.B))
+}
+
+// parseHexColor reads "#rrggbb" or "#rgb", the "#" being optional
+func parseHexColor(s string) (color.NRGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if len(h) != 6 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ExtractPalette returns the dominant colours of the visible pixels of img,
+// heaviest first; empty for a fully transparent image. Similar shades
+// (anti-aliasing, gradients) are merged.
+func ExtractPalette(img image.Image) []PaletteColor {
+	b := img.Bounds()
+	step := max(1, int(math.Sqrt(float64(b.Dx()*b.Dy())/maxPaletteSamples)))
+
+	// Coarse 4-bit buckets first, keeping the exact mean of each
+	type cluster struct {
+		r, g, b, n float64
+		lab        labColor
+	}
+	buckets := map[int]*cluster{}
+	total := 0.0
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			k := buckets[key]
+			if k == nil {
+				k = &cluster{}
+				buckets[key] = k
+			}
+			k.r, k.g, k.b, k.n = k.r+float64(c.R), k.g+float64(c.G), k.b+float64(c.B), k.n+1
+			total++
+		}
+	}
+	if total == 0 {
+		return []PaletteColor{}
+	}
+
+	mean := func(k *cluster) color.NRGBA {
+		return color.NRGBA{R: uint8(math.Round(k.r / k.n)), G: uint8(math.Round(k.g / k.n)), B: uint8(math.Round(k.b / k.n)), A: 255}
+	}
+	sorted := make([]*cluster, 0, len(buckets))
+	for _, k := range buckets {
+		k.lab = toLab(mean(k))
+		sorted = append(sorted, k)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].n > sorted[j].n })
+
+	// Merge each bucket into the heaviest close cluster
+	var clusters []*cluster
+	for _, k := range sorted {
+		merged := false
+		for _, c := range clusters {
+			if c.lab.distance(k.lab) < paletteMergeDelta {
+				c.r, c.g, c.b, c.n = c.r+k.r, c.g+k.g, c.b+k.b, c.n+k.n
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			clusters = append(clusters, &cluster{r: k.r, g: k.g, b: k.b, n: k.n, lab: k.lab})
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].n > clusters[j].n })
+
+	palette := []PaletteColor{}
+	for _, c := range clusters {
+		weight := c.n / total
+		if weight < minPaletteWeight || len(palette) == maxPaletteColors {
+			break
+		}
+		palette = append(palette, PaletteColor{Hex: hexColor(mean(c)), Weight: math.Round(weight*1000) / 1000})
+	}
+	return palette
+}
+
+// paletteSimilarity compares two palettes from 0 (unrelated) to 1 (same
+// colours in the same proportions). Each colour counts with its weight and
+// scores by the distance to the closest colour of the other palette, in
+// both directions.
+func paletteSimilarity(a, b []PaletteColor) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	labs := func(p []PaletteColor) []labColor {
+		out := make([]labColor, 0, len(p))
+		for _, pc := range p {
+			c, _ := parseHexColor(pc.Hex)
+			out = append(out, toLab(c))
+		}
+		return out
+	}
+	labA, labB := labs(a), labs(b)
+	oneWay := func(p []PaletteColor, from, to []labColor) float64 {
+		score, total := 0.0, 0.0
+		for i, c := range from {
+			closest := math.MaxFloat64
+			for _, o := range to {
+				closest = math.Min(closest, c.distance(o))
+			}
+			score += p[i].Weight * math.Max(0, 1-closest/paletteMatchDelta)
+			total += p[i].Weight
+		}
+		if total == 0 {
+			return 0
+		}
+		return score / total
+	}
+	return (oneWay(a, labA, labB) + oneWay(b, labB, labA)) / 2
+}
+
+// encodePalette is the value of a palette column, NULL without a palette
+func encodePalette(p []PaletteColor) interface{} {
+	if p == nil {
+		return nil
+	}
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+// decodePalette reads a palette column
+func decodePalette(s sql.NullString) []PaletteColor {
+	var p []PaletteColor
+	if s.Valid {
+		json.Unmarshal([]byte(s.String), &p)
+	}
+	return p
+}
+
+// parseClubColors reads the comma-separated club_colors column
+func parseClubColors(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// indexLogoColors refreshes the colours GET /logos filters on: the official
+// club colours when set, the extracted palette otherwise
+func indexLogoColors(id string) error {
+	var palette, clubColors sql.NullString
+	err := db.QueryRow("SELECT palette, club_colors FROM logos WHERE id = ?", id).Scan(&palette, &clubColors)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	colors := decodePalette(palette)
+	if official := parseClubColors(clubColors.String); len(official) > 0 {
+		colors = nil
+		for _, hex := range official {
+			colors = append(colors, PaletteColor{Hex: hex, Weight: 1 / float64(len(official))})
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM logo_colors WHERE logo_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, pc := range colors {
+		c, err := parseHexColor(pc.Hex)
+		if err != nil {
+			continue
+		}
+		lab := toLab(c)
+		if _, err := tx.Exec("INSERT INTO logo_colors (logo_id, hex, weight, lab_l, lab_a, lab_b) VALUES (?, ?, ?, ?, ?, ?)",
+			id, pc.Hex, pc.Weight, lab.L, lab.A, lab.B); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// colorFilter returns the WHERE condition matching logos with a colour close
+// to hex, for GET /logos?color=
+func colorFilter(hex, distance string) (string, []interface{}, error) {
+	c, err := parseHexColor(hex)
+	if err != nil {
+		return "", nil, err
+	}
+	maxDelta := float64(defaultColorDistance)
+	if distance != "" {
+		maxDelta, err = strconv.ParseFloat(distance, 64)
+		if err != nil || maxDelta <= 0 || maxDelta > maxColorDistance {
+			return "", nil, fmt.Errorf("color_distance must be between 0 and %d", maxColorDistance)
+		}
+	}
+	lab := toLab(c)
+	where := `EXISTS (SELECT 1 FROM logo_colors lc WHERE lc.logo_id = l.id AND lc.weight >= ?
+		AND (lc.lab_l - ?) * (lc.lab_l - ?) + (lc.lab_a - ?) * (lc.lab_a - ?) + (lc.lab_b - ?) * (lc.lab_b - ?) <= ?)`
+	return where, []interface{}{minColorFilterWeight, lab.L, lab.L, lab.A, lab.A, lab.B, lab.B, maxDelta * maxDelta}, nil
+}
+
+// paletteBackfill extracts the palette of logos stored before palettes were
+// tracked; see backfillLogoPNGs
+var paletteBackfill = pngBackfill{
+	column: "palette",
+	label:  "colour palettes",
+	value: func(img image.Image) (interface{}, interface{}) {
+		if img == nil {
+			return encodePalette([]PaletteColor{}), nil
+		}
+		return encodePalette(ExtractPalette(img)), nil
+	},
+	done: indexLogoColors,
+}
+
+// ==================== Colour Handlers ====================
+
+// setLogoColors sets the official club colours, which take precedence over
+// the extracted palette when filtering. An empty list clears them.
+func setLogoColors(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+
+	var req struct {
+		Colors []string `json:"colors"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if len(req.Colors) > maxClubColors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d colours", maxClubColors)})
+		return
+	}
+	colors := make([]string, 0, len(req.Colors))
+	for _, s := range req.Colors {
+		col, err := parseHexColor(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		colors = append(colors, hexColor(col))
+	}
+
+	res, err := db.Exec("UPDATE logos SET club_colors = ? WHERE id = ?", nullString(strings.Join(colors, ",")), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+	if err := indexLogoColors(id); err != nil {
+		log.Printf("Warning: Failed to index colours of logo %s: %v", id, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id, "club_colors": colors})
+}
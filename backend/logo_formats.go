@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// derivedFormat describes an output format generated lazily from the PNG master
+type derivedFormat struct {
+	Name        string
+	Ext         string
+	ContentType string
+	Convert     func(pngPath, outPath string) error
+}
+
+// derivedFormats lists formats that are encoded on demand, in order of
+// preference when negotiating via the Accept header.
+var derivedFormats = []derivedFormat{
+	{
+		Name:        "avif",
+		Ext:         ".avif",
+		ContentType: "image/avif",
+		Convert:     ConvertPNGToAVIF,
+	},
+	{
+		Name:        "webp",
+		Ext:         ".webp",
+		ContentType: "image/webp",
+		Convert:     ConvertPNGToWebP,
+	},
+}
+
+func findDerivedFormat(name string) (derivedFormat, bool) {
+	for _, f := range derivedFormats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return derivedFormat{}, false
+}
+
+// availableFormats holds the derived formats whose encoder works; see
+// probeDerivedFormats
+var (
+	availableFormats     map[string]bool
+	availableFormatsOnce sync.Once
+)
+
+// probeDerivedFormats encodes a small image in every derived format once and
+// remembers which encoders worked. An encoder on PATH is not enough:
+// ImageMagick may be built without AVIF or WebP support.
+func probeDerivedFormats() {
+	availableFormatsOnce.Do(func() {
+		availableFormats = map[string]bool{}
+		workDir, err := os.MkdirTemp("", "logo-probe-*")
+		if err != nil {
+			log.Printf("Warning: Cannot probe image encoders: %v", err)
+			return
+		}
+		defer os.RemoveAll(workDir)
+
+		img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+		for i := 0; i < 8; i++ {
+			img.Set(4+i, 4+i, color.NRGBA{200, 16, 46, 255})
+		}
+		pngPath := filepath.Join(workDir, "probe.png")
+		file, err := os.Create(pngPath)
+		if err == nil {
+			err = png.Encode(file, img)
+			file.Close()
+		}
+		if err != nil {
+			log.Printf("Warning: Cannot probe image encoders: %v", err)
+			return
+		}
+
+		var names []string
+		for _, f := range derivedFormats {
+			outPath := filepath.Join(workDir, "probe"+f.Ext)
+			if err := f.Convert(pngPath, outPath); err != nil {
+				continue
+			}
+			if info, err := os.Stat(outPath); err == nil && info.Size() > 0 {
+				availableFormats[f.Name] = true
+				names = append(names, f.Name)
+			}
+		}
+		if len(names) == 0 {
+			names = []string{"none"}
+		}
+		log.Printf("🖼️  Derived image formats: %s", strings.Join(names, ", "))
+	})
+}
+
+// Available reports whether the format's encoder passed the probe
+func (f derivedFormat) Available() bool {
+	probeDerivedFormats()
+	return availableFormats[f.Name]
+}
+
+// negotiateLogoFormat picks the best derived format the client explicitly
+// accepts. Wildcards such as image/* or */* never pick one, but browsers list
+// image/avif and image/webp explicitly and get those when available; other
+// clients get PNG. Returns an empty string when PNG should be served.
+func negotiateLogoFormat(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		for _, f := range derivedFormats {
+			// derivedFormats is ordered by preference, so only a higher q wins
+			if mediaType == f.ContentType && q > bestQ && f.Available() {
+				best, bestQ = f.Name, q
+			}
+		}
+	}
+	return best
+}
+
+// ensureDerivedLogo returns the storage key of the logo encoded in the given
+// format, optionally resized, generating it from the PNG master (or a PNG
+// variant rendered from the SVG) when missing or stale.
+func ensureDerivedLogo(ctx context.Context, id string, f derivedFormat, width, height int) (string, error) {
+	srcKey := logoKey("png", id)
+	outKey := f.Name + "/" + id + f.Ext
+
+	srcInfo, err := store.Stat(ctx, srcKey)
+	if width > 0 || height > 0 || err != nil {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if width == 0 && height == 0 {
+			// SVG-only logo: encode from a rendering at the default master size
+			width, height = 512, 512
+		} else {
+			outKey = logoVariantKey(id, width, height, f.Ext)
+		}
+		if srcKey, err = ensureLogoVariant(ctx, id, width, height); err != nil {
+			return "", err
+		}
+		if srcInfo, err = store.Stat(ctx, srcKey); err != nil {
+			return "", err
+		}
+	}
+
+	if info, err := store.Stat(ctx, outKey); err == nil && !info.ModTime.Before(srcInfo.ModTime) {
+		return outKey, nil
+	}
+
+	data, _, err := readObject(ctx, srcKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Encoders work on files and pick the output type from the extension
+	workDir, err := os.MkdirTemp("", "logo-derive-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	pngPath := filepath.Join(workDir, "source.png")
+	outPath := filepath.Join(workDir, "output"+f.Ext)
+	if err := os.WriteFile(pngPath, data, 0644); err != nil {
+		return "", err
+	}
+	if err := f.Convert(pngPath, outPath); err != nil {
+		return "", err
+	}
+	if err := putFile(ctx, outKey, outPath, f.ContentType); err != nil {
+		return "", err
+	}
+
+	return outKey, nil
+}
+
+// clearDerivedLogos removes full-size derived files of a logo
+func clearDerivedLogos(ctx context.Context, id string) {
+	for _, f := range derivedFormats {
+		store.Delete(ctx, f.Name+"/"+id+f.Ext)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reverse image search limits and scoring. Query images are scaled down to
+// imageSearchSize before anything else, the hash and palette need no more.
+// The score mixes the perceptual hash similarity (1 at distance 0, 0 at
+// imageSearchHashSpan bits and more) with the palette similarity.
+const (
+	maxSearchImageSize       = 10 << 20 // 10 MB
+	maxSearchImagePixels     = 16_000_000
+	imageSearchSize          = 256
+	defaultImageSearchLimit  = 10
+	maxImageSearchLimit      = 50
+	imageSearchHashSpan      = 32
+	imageSearchHashWeight    = 0.7
+	imageSearchPaletteWeight = 0.3
+)
+
+// ImageSearchMatch is a stored logo scored against a query image
+type ImageSearchMatch struct {
+	ID              string  `json:"id"`
+	ClubName        string  `json:"club_name"`
+	ClubCity        string  `json:"club_city,omitempty"`
+	Score           float64 `json:"score"`
+	Distance        int     `json:"distance"`
+	ColorSimilarity float64 `json:"color_similarity"`
+	LogoURL         string  `json:"logo_url"`
+}
+
+// imageSearchFeatures prepares a query image the way uploads are processed
+// (background removal, trimming, square canvas), at imageSearchSize, and
+// returns the features stored for every logo: the perceptual hash and the
+// palette. Everything runs in-process, SVGs are rendered with the pure-Go
+// renderer.
+func imageSearchFeatures(data []byte) (hash string, palette []PaletteColor, backgroundRemoved bool, err error) {
+	var img image.Image
+	switch format := DetectImageFormat(data); format {
+	case "svg":
+		if img, err = renderSVG(bytes.NewReader(data), imageSearchSize, 0); err != nil {
+			return "", nil, false, err
+		}
+	case "png", "jpeg", "webp", "gif":
+		if err := checkRasterImageSize(data, format, maxSearchImagePixels); err != nil {
+			return "", nil, false, err
+		}
+		if img, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return "", nil, false, err
+		}
+		if b := img.Bounds(); b.Dx() > imageSearchSize || b.Dy() > imageSearchSize {
+			img = ResizeImage(img, imageSearchSize, imageSearchSize)
+		}
+		// Photos and screenshots usually have a plain background the stored
+		// logos do not have
+		img, _, backgroundRemoved = RemoveBackground(img, defaultBackgroundTolerance)
+	default:
+		return "", nil, false, fmt.Errorf("unsupported file type %s, expected SVG, PNG, JPEG, WebP or GIF", http.DetectContentType(data))
+	}
+
+	normalized, _ := NormalizeLogo(img, imageSearchSize, logoPadding())
+	return PerceptualHash(normalized), ExtractPalette(normalized), backgroundRemoved, nil
+}
+
+// matchLogosByFeatures scores every logo with a PNG against the query
+// features and returns the best matches
+func matchLogosByFeatures(hash string, palette []PaletteColor, limit int) ([]ImageSearchMatch, error) {
+	rows, err := db.Query("SELECT id, club_name, club_city, phash, palette FROM logos WHERE phash IS NOT NULL AND phash != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []ImageSearchMatch{}
+	for rows.Next() {
+		var m ImageSearchMatch
+		var city, stored sql.NullString
+		var other string
+		if err := rows.Scan(&m.ID, &m.ClubName, &city, &other, &stored); err != nil {
+			return nil, err
+		}
+		if m.Distance = hashDistance(hash, other); m.Distance < 0 {
+			continue
+		}
+		m.ClubCity = city.String
+		m.ColorSimilarity = paletteSimilarity(palette, decodePalette(stored))
+		hashSimilarity := math.Max(0, 1-float64(m.Distance)/imageSearchHashSpan)
+		m.Score = imageSearchHashWeight*hashSimilarity + imageSearchPaletteWeight*m.ColorSimilarity
+		m.Score = math.Round(m.Score*1000) / 1000
+		m.ColorSimilarity = math.Round(m.ColorSimilarity*1000) / 1000
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ClubName < matches[j].ClubName
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// ==================== Image Search Handlers ====================
+
+// searchLogosByImage finds the clubs whose logo looks like an uploaded
+// image, best match first. Nothing is stored.
+func searchLogosByImage(c *gin.Context) {
+	limit := defaultImageSearchLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = min(l, maxImageSearchLimit)
+	}
+
+	// Refuse oversized bodies while reading them, not after
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSearchImageSize+1<<20)
+	file, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && file.Size > maxSearchImageSize) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file is larger than %d MB", maxSearchImageSize>>20)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no file provided"})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read upload"})
+		return
+	}
+
+	hash, palette, backgroundRemoved, err := imageSearchFeatures(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	matches, err := matchLogosByFeatures(hash, palette, limit)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	baseURL := requestBaseURL(c)
+	for i := range matches {
+		matches[i].LogoURL = fmt.Sprintf("%s/logos/%s", baseURL, matches[i].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"phash":              hash,
+		"palette":            palette,
+		"background_removed": backgroundRemoved,
+		"items":              matches,
+	})
+}
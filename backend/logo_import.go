@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Limits for logos downloaded by POST /logos/:id/import
+const (
+	maxImportSize      = 10 << 20 // 10 MB
+	importTimeout      = 30 * time.Second
+	maxImportRedirects = 5
+)
+
+// errPrivateAddress is returned when an import URL resolves to a loopback,
+// private or link-local address. Set IMPORT_ALLOW_PRIVATE_HOSTS=true to allow
+// them, e.g. for a local test server.
+var errPrivateAddress = errors.New("refusing to download from a private address")
+
+// importClient downloads remote logos. It connects only to public addresses,
+// also after redirects, so imports cannot reach internal services.
+var importClient = &http.Client{
+	Timeout: importTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkImportAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxImportRedirects {
+			return permanent(fmt.Errorf("stopped after %d redirects", maxImportRedirects))
+		}
+		return checkImportURL(req.URL)
+	},
+}
+
+// checkImportURL accepts absolute http(s) URLs only
+func checkImportURL(u *neturl.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return permanent(fmt.Errorf("only http and https URLs can be imported"))
+	}
+	return nil
+}
+
+// checkImportAddress runs before each connection of importClient, once the
+// host name has been resolved
+func checkImportAddress(network, address string, _ syscall.RawConn) error {
+	if os.Getenv("IMPORT_ALLOW_PRIVATE_HOSTS") == "true" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// downloadLogo fetches a remote file within the import limits. Failures that
+// a retry cannot fix (client errors, oversized files, blocked addresses) are
+// permanent.
+func downloadLogo(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36")
+	req.Header.Set("Accept", "image/svg+xml,image/png,application/pdf,image/webp,image/jpeg,image/gif,image/*;q=0.8,*/*;q=0.5")
+
+	resp, err := importClient.Do(req)
+	if err != nil {
+		var perm permanentError
+		if errors.Is(err, errPrivateAddress) || errors.As(err, &perm) {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download failed with status %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, permanent(err)
+		}
+		return nil, err
+	}
+	if resp.ContentLength > maxImportSize {
+		return nil, permanent(fmt.Errorf("file is larger than %d MB", maxImportSize>>20))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, permanent(fmt.Errorf("file is larger than %d MB", maxImportSize>>20))
+	}
+	return data, nil
+}
+
+// ==================== Import Handlers ====================
+
+// importLogo queues the download of a logo from a URL, by default the club's
+// logo on fotbal.cz. The file goes through the same processing as an upload.
+func importLogo(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+
+	var req struct {
+		URL         string  `json:"url"`
+		ClubName    string  `json:"club_name"`
+		ClubCity    string  `json:"club_city"`
+		ClubType    string  `json:"club_type"`
+		ClubWebsite string  `json:"club_website"`
+		ClubAliases *string `json:"club_aliases"`
+
+		RemoveBackground    bool `json:"remove_background"`
+		BackgroundTolerance int  `json:"background_tolerance"`
+		Padding             *int `json:"padding"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+
+	form := logoUploadForm{
+		LogoID:      id,
+		ClubName:    strings.TrimSpace(req.ClubName),
+		ClubCity:    strings.TrimSpace(req.ClubCity),
+		ClubType:    strings.TrimSpace(req.ClubType),
+		ClubWebsite: strings.TrimSpace(req.ClubWebsite),
+
+		RemoveBackground:    req.RemoveBackground,
+		BackgroundTolerance: req.BackgroundTolerance,
+		Padding:             req.Padding,
+	}
+	if form.BackgroundTolerance == 0 {
+		form.BackgroundTolerance = defaultBackgroundTolerance
+	}
+	if form.BackgroundTolerance < 1 || form.BackgroundTolerance > maxBackgroundTolerance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("background_tolerance must be between 1 and %d", maxBackgroundTolerance)})
+		return
+	}
+	if form.Padding != nil && (*form.Padding < 0 || *form.Padding > maxLogoPadding) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("padding must be between 0 and %d", maxLogoPadding)})
+		return
+	}
+	sourceURL := strings.TrimSpace(req.URL)
+
+	// The club page provides both missing metadata and the default URL
+	var club *Club
+	if sourceURL == "" || form.ClubName == "" {
+		club, _ = fetchClubByID(c.Request.Context(), id)
+	}
+	form.fillFromClub(club)
+	if sourceURL == "" {
+		if club == nil || club.LogoURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "url is required, no FAČR logo is known for this club"})
+			return
+		}
+		sourceURL = club.LogoURL
+	}
+
+	u, err := neturl.Parse(sourceURL)
+	if err == nil {
+		err = checkImportURL(u)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid url: " + err.Error()})
+		return
+	}
+
+	payload := logoJobPayload{Form: form, SourceURL: u.String(), Aliases: req.ClubAliases}
+	if key := currentAPIKey(c); key != nil {
+		payload.UploadedBy = key.Name
+		payload.APIKeyID = key.ID
+	}
+	job, err := enqueueJob("", JobKindLogoImport, id, &payload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":    true,
+		"id":         id,
+		"source_url": payload.SourceURL,
+		"job":        job,
+		"status_url": jobStatusURL(c, job.ID),
+		"message":    "logo import queued",
+	})
+}
+
+// runLogoImportJob downloads a logo, identifies its format by content and
+// publishes it like an upload
+func runLogoImportJob(ctx context.Context, job *Job, lastAttempt bool) (interface{}, error) {
+	var payload logoJobPayload
+	if err := json.Unmarshal(job.payload, &payload); err != nil {
+		return nil, permanent(err)
+	}
+
+	data, err := downloadLogo(ctx, payload.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	format := DetectImageFormat(data)
+	ext, ok := uploadExtensions[format]
+	if !ok {
+		return nil, permanent(fmt.Errorf("unsupported file type %s, expected SVG, PNG, PDF, JPEG, WebP or GIF", http.DetectContentType(data)))
+	}
+	payload.Form.Ext = ext
+
+	result, err := publishLogoUpload(ctx, &payload, data, lastAttempt)
+	if err != nil {
+		return nil, err
+	}
+	result["source_url"] = payload.SourceURL
+	return result, nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Padding around the crest, in percent of the canvas side on each side.
+// LOGO_PADDING changes the default, uploads may set their own.
+const (
+	defaultLogoPadding = 5
+	maxLogoPadding     = 25
+)
+
+// Side of the PNG master rendered from SVG and PDF uploads, and the widest
+// rendering made for it; see renderVectorLogo
+const (
+	logoCanvasSize    = 512
+	maxLogoRenderSize = 4096
+)
+
+// LogoBounds is the box the crest occupies inside the PNG master
+type LogoBounds struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// logoNormalization describes how a PNG master was normalized. Bounds is nil
+// when the image has no visible pixels; AspectRatio is width/height of the
+// trimmed crest before scaling.
+type logoNormalization struct {
+	Bounds      *LogoBounds
+	AspectRatio float64
+	Changed     bool
+}
+
+// logoPadding returns the default padding from LOGO_PADDING
+func logoPadding() int {
+	if v, err := strconv.Atoi(os.Getenv("LOGO_PADDING")); err == nil && v >= 0 && v <= maxLogoPadding {
+		return v
+	}
+	return defaultLogoPadding
+}
+
+// parseLogoPadding reads the padding form field, empty means the default
+func parseLogoPadding(v string) (*int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	padding, err := strconv.Atoi(v)
+	if err != nil || padding < 0 || padding > maxLogoPadding {
+		return nil, fmt.Errorf("padding must be between 0 and %d", maxLogoPadding)
+	}
+	return &padding, nil
+}
+
+// contentBounds returns the smallest rectangle holding all visible pixels
+func contentBounds(img *image.NRGBA) (image.Rectangle, bool) {
+	b := img.Bounds()
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X-1, b.Min.Y-1
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if row[(x-b.Min.X)*4+3] == 0 {
+				continue
+			}
+			minX, maxX = min(minX, x), max(maxX, x)
+			minY, maxY = min(minY, y), max(maxY, y)
+		}
+	}
+	if maxX < minX {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(minX, minY, maxX+1, maxY+1), true
+}
+
+// NormalizeLogo trims transparent margins and centres the crest on a square
+// canvas with padding percent of the side left free on each side. With size > 0
+// the crest is scaled to fit a size x size canvas, otherwise the resolution is
+// kept and the canvas is derived from the crest.
+func NormalizeLogo(src image.Image, size, padding int) (*image.NRGBA, logoNormalization) {
+	b := src.Bounds()
+	img := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+
+	content, ok := contentBounds(img)
+	if !ok {
+		return img, logoNormalization{}
+	}
+	tw, th := float64(content.Dx()), float64(content.Dy())
+	free := 1 - 2*float64(padding)/100
+
+	side, scale := size, 1.0
+	if size > 0 {
+		inner := float64(size) * free
+		scale = math.Min(inner/tw, inner/th)
+	} else {
+		side = int(math.Ceil(math.Max(tw, th) / free))
+	}
+	w := max(1, int(math.Round(tw*scale)))
+	h := max(1, int(math.Round(th*scale)))
+	box := image.Rect((side-w)/2, (side-h)/2, (side-w)/2+w, (side-h)/2+h)
+
+	norm := logoNormalization{
+		Bounds:      &LogoBounds{X: box.Min.X, Y: box.Min.Y, Width: w, Height: h},
+		AspectRatio: math.Round(tw/th*10000) / 10000,
+	}
+	if side == img.Bounds().Dx() && side == img.Bounds().Dy() && box == content {
+		return img, norm
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, side, side))
+	if w == content.Dx() && h == content.Dy() {
+		draw.Draw(dst, box, img, content.Min, draw.Src)
+	} else {
+		xdraw.CatmullRom.Scale(dst, box, img, content, xdraw.Src, nil)
+	}
+	norm.Changed = true
+	return dst, norm
+}
+
+// vectorRenderWidth returns the width to render a drawing at for its trimmed
+// crest to fill a side x side canvas with padding without upscaling, given
+// img rendered width wide. It is 0 when img will do, and at most
+// maxLogoRenderSize.
+func vectorRenderWidth(img image.Image, width, side, padding int) int {
+	content, ok := imageContentBounds(img)
+	if !ok {
+		return 0
+	}
+	inner := float64(side) * (1 - 2*float64(padding)/100)
+	// Not counting the anti-aliased pixel the crest may have on each side
+	crest := float64(max(1, max(content.Dx(), content.Dy())-2))
+	larger := min(maxLogoRenderSize, int(math.Ceil(float64(width)*inner/crest)))
+	if larger <= width {
+		return 0
+	}
+	return larger
+}
+
+// masterPadding estimates the padding a normalized PNG master was made with
+// from where its crest sits
+func masterPadding(img image.Image) (int, bool) {
+	b := img.Bounds()
+	content, ok := imageContentBounds(img)
+	if !ok || b.Dx() != b.Dy() {
+		return 0, false
+	}
+	padding := int(math.Round((1 - float64(max(content.Dx(), content.Dy()))/float64(b.Dx())) * 50))
+	return min(max(padding, 0), maxLogoPadding), true
+}
+
+// renderVectorLogo renders an SVG or PDF upload into pngPath for a
+// logoCanvasSize master. The first rendering is twice the canvas wide; when
+// the crest covers only part of the drawing, it is rendered again wide
+// enough (up to maxLogoRenderSize) for the trimmed crest to fill the canvas
+// without upscaling.
+func renderVectorLogo(render func(pngPath string, width int) error, pngPath string, padding int) error {
+	width := 2 * logoCanvasSize
+	if err := render(pngPath, width); err != nil {
+		return err
+	}
+
+	f, err := os.Open(pngPath)
+	if err != nil {
+		return err
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	larger := vectorRenderWidth(img, width, logoCanvasSize, padding)
+	if larger == 0 {
+		return nil
+	}
+
+	// Keep the first rendering if the larger one fails
+	largerPath := strings.TrimSuffix(pngPath, ".png") + ".large.png"
+	if err := render(largerPath, larger); err != nil {
+		log.Printf("Warning: Failed to render the logo at %dpx: %v", larger, err)
+		os.Remove(largerPath)
+		return nil
+	}
+	return os.Rename(largerPath, pngPath)
+}
+
+// normalizeLogoFile normalizes a PNG file in place (see NormalizeLogo)
+func normalizeLogoFile(pngPath string, size, padding int) (logoNormalization, error) {
+	f, err := os.Open(pngPath)
+	if err != nil {
+		return logoNormalization{}, err
+	}
+	img, err := png.Decode(f)
+	f.Close()
+	if err != nil {
+		return logoNormalization{}, err
+	}
+
+	out, norm := NormalizeLogo(img, size, padding)
+	if !norm.Changed {
+		return norm, nil
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return norm, err
+	}
+	return norm, os.WriteFile(pngPath, buf.Bytes(), 0644)
+}
+
+// encodeBounds is the value of a bbox column, NULL without bounds
+func encodeBounds(b *LogoBounds) interface{} {
+	if b == nil {
+		return nil
+	}
+	data, _ := json.Marshal(b)
+	return string(data)
+}
+
+// decodeBounds reads a bbox column
+func decodeBounds(s sql.NullString) *LogoBounds {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	var b LogoBounds
+	if err := json.Unmarshal([]byte(s.String), &b); err != nil {
+		return nil
+	}
+	return &b
+}
+
+// pngBackfill fills in a logos column that is NULL for logos stored before
+// it was tracked, computed from the PNG master
+type pngBackfill struct {
+	column string
+	label  string
+	// value returns the column value, and optionally the aspect ratio for
+	// logos without one. img is nil when the PNG cannot be read; such logos
+	// get an empty value so they are not retried on every start.
+	value func(img image.Image) (value, aspectRatio interface{})
+	// done runs after the logo's column was set
+	done func(id string) error
+}
+
+// pngBackfills run together in backfillLogoPNGs
+var pngBackfills = []pngBackfill{boundsBackfill, paletteBackfill, phashBackfill}
+
+// boundsBackfill records where the crest sits in the PNG, which is left as it is
+var boundsBackfill = pngBackfill{
+	column: "bbox",
+	label:  "logo bounds",
+	value: func(img image.Image) (interface{}, interface{}) {
+		content, ok := imageContentBounds(img)
+		if !ok {
+			return "", nil
+		}
+		bounds := &LogoBounds{X: content.Min.X, Y: content.Min.Y, Width: content.Dx(), Height: content.Dy()}
+		return encodeBounds(bounds), math.Round(float64(content.Dx())/float64(content.Dy())*10000) / 10000
+	},
+}
+
+// imageContentBounds returns the box of visible pixels of img, which may be nil
+func imageContentBounds(img image.Image) (image.Rectangle, bool) {
+	if img == nil {
+		return image.Rectangle{}, false
+	}
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	return contentBounds(nrgba)
+}
+
+// backfillLogoPNGs fills in the pngBackfills columns of logos stored before
+// they were tracked, reading and decoding each PNG master once. The current
+// revision gets the same values. Uploads running meanwhile win: a column is
+// only set while it is still NULL.
+func backfillLogoPNGs(ctx context.Context) error {
+	missing := make([]string, len(pngBackfills))
+	for i, backfill := range pngBackfills {
+		missing[i] = backfill.column + " IS NULL"
+	}
+	rows, err := db.Query("SELECT id, current_revision, " + strings.Join(missing, ", ") +
+		" FROM logos WHERE has_png = 1 AND (" + strings.Join(missing, " OR ") + ")")
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id       string
+		revision sql.NullInt64
+		missing  []bool // by pngBackfills index
+	}
+	var logos []pending
+	for rows.Next() {
+		p := pending{missing: make([]bool, len(pngBackfills))}
+		dest := []interface{}{&p.id, &p.revision}
+		for i := range p.missing {
+			dest = append(dest, &p.missing[i])
+		}
+		if err := rows.Scan(dest...); err == nil {
+			logos = append(logos, p)
+		}
+	}
+	rows.Close()
+
+	counts := make([]int, len(pngBackfills))
+	for _, p := range logos {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var img image.Image
+		if data, _, err := readObject(ctx, logoKey("png", p.id)); err == nil {
+			img, _, _ = image.Decode(bytes.NewReader(data))
+		}
+		for i, backfill := range pngBackfills {
+			if !p.missing[i] {
+				continue
+			}
+			value, ratio := backfill.value(img)
+			res, err := db.Exec("UPDATE logos SET "+backfill.column+" = ?, aspect_ratio = COALESCE(aspect_ratio, ?) WHERE id = ? AND "+backfill.column+" IS NULL",
+				value, ratio, p.id)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			if p.revision.Valid {
+				db.Exec("UPDATE logo_revisions SET "+backfill.column+" = ?, aspect_ratio = COALESCE(aspect_ratio, ?) WHERE logo_id = ? AND revision = ? AND "+backfill.column+" IS NULL",
+					value, ratio, p.id, p.revision.Int64)
+			}
+			if backfill.done != nil {
+				if err := backfill.done(p.id); err != nil {
+					return err
+				}
+			}
+			counts[i]++
+		}
+	}
+	for i, n := range counts {
+		if n > 0 {
+			log.Printf("✓ Backfilled %s for %d logos", pngBackfills[i].label, n)
+		}
+	}
+	return nil
+}
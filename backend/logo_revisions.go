@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// LogoRevision is one immutable upload of a club's logo
+type LogoRevision struct {
+	LogoID              string         `json:"logo_id"`
+	Revision            int            `json:"revision"`
+	ClubName            string         `json:"club_name"`
+	ClubCity            string         `json:"club_city,omitempty"`
+	ClubType            string         `json:"club_type,omitempty"`
+	ClubWebsite         string         `json:"club_website,omitempty"`
+	HasSVG              bool           `json:"has_svg"`
+	HasPNG              bool           `json:"has_png"`
+	FileSizeSVG         int64          `json:"file_size_svg,omitempty"`
+	FileSizePNG         int64          `json:"file_size_png,omitempty"`
+	FileSizeSVGOriginal int64          `json:"file_size_svg_original,omitempty"`
+	SourceFormat        string         `json:"source_format,omitempty"`
+	FileSizeSource      int64          `json:"file_size_source,omitempty"`
+	BackgroundRemoved   bool           `json:"background_removed"`
+	Bounds              *LogoBounds    `json:"bbox,omitempty"`
+	AspectRatio         float64        `json:"aspect_ratio,omitempty"`
+	Palette             []PaletteColor `json:"palette,omitempty"`
+	PHash               string         `json:"phash,omitempty"`
+	HashSVG             string         `json:"hash_svg,omitempty"`
+	HashPNG             string         `json:"hash_png,omitempty"`
+	UploadedBy          string         `json:"uploaded_by,omitempty"`
+	APIKeyID            string         `json:"api_key_id,omitempty"`
+	SubmissionID        string         `json:"submission_id,omitempty"`
+	Current             bool           `json:"current"`
+	LogoURLSVG          string         `json:"logo_url_svg,omitempty"`
+	LogoURLPNG          string         `json:"logo_url_png,omitempty"`
+	LogoURLSVGOriginal  string         `json:"logo_url_svg_original,omitempty"`
+	LogoURLSource       string         `json:"logo_url_source,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+}
+
+// revisionKey returns the storage key of a revision's master file. The
+// unoptimized SVG is kept under the "original.svg" format, an uploaded raster
+// file under sourceKeyFormat.
+func revisionKey(id string, revision int, format string) string {
+	return fmt.Sprintf("revisions/%s/%d/%s.%s", id, revision, id, format)
+}
+
+// sourceKeyFormat returns the format under which an uploaded raster source
+// of the given format is stored, e.g. "source.jpg"
+func sourceKeyFormat(format string) string {
+	return "source" + rasterSourceFormats[format].Ext
+}
+
+const revisionColumns = `logo_id, revision, club_name, club_city, club_type, club_website,
+	has_svg, has_png, file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source,
+	background_removed, bbox, aspect_ratio, palette, phash, svg_hash, png_hash, uploaded_by, api_key_id, submission_id, created_at`
+
+func scanLogoRevision(row interface{ Scan(...interface{}) error }) (*LogoRevision, error) {
+	var rev LogoRevision
+	var clubCity, clubType, clubWebsite, hashSVG, hashPNG, uploadedBy, apiKeyID, submissionID, sourceFormat, bounds, palette, phash sql.NullString
+	var sizeSVG, sizePNG, sizeSVGOriginal, sizeSource sql.NullInt64
+	var aspectRatio sql.NullFloat64
+	var hasSVG, hasPNG, backgroundRemoved int
+	if err := row.Scan(
+		&rev.LogoID, &rev.Revision, &rev.ClubName, &clubCity, &clubType, &clubWebsite,
+		&hasSVG, &hasPNG, &sizeSVG, &sizePNG, &sizeSVGOriginal, &sourceFormat, &sizeSource, &backgroundRemoved, &bounds, &aspectRatio, &palette, &phash, &hashSVG, &hashPNG, &uploadedBy, &apiKeyID, &submissionID, &rev.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	rev.ClubCity = clubCity.String
+	rev.ClubType = clubType.String
+	rev.ClubWebsite = clubWebsite.String
+	rev.HasSVG = hasSVG == 1
+	rev.HasPNG = hasPNG == 1
+	rev.FileSizeSVG = sizeSVG.Int64
+	rev.FileSizePNG = sizePNG.Int64
+	rev.FileSizeSVGOriginal = sizeSVGOriginal.Int64
+	rev.SourceFormat = sourceFormat.String
+	rev.FileSizeSource = sizeSource.Int64
+	rev.BackgroundRemoved = backgroundRemoved == 1
+	rev.Bounds = decodeBounds(bounds)
+	rev.AspectRatio = aspectRatio.Float64
+	rev.Palette = decodePalette(palette)
+	rev.PHash = phash.String
+	rev.HashSVG = hashSVG.String
+	rev.HashPNG = hashPNG.String
+	rev.UploadedBy = uploadedBy.String
+	rev.APIKeyID = apiKeyID.String
+	rev.SubmissionID = submissionID.String
+	return &rev, nil
+}
+
+func loadLogoRevision(id string, revision int) (*LogoRevision, error) {
+	return scanLogoRevision(db.QueryRow(
+		"SELECT "+revisionColumns+" FROM logo_revisions WHERE logo_id = ? AND revision = ?", id, revision))
+}
+
+// commitLogoRevision stores freshly processed master files as a new revision
+// and makes it the current logo. svgPath/pngPath are local files and are only
+// read when rev.HasSVG/rev.HasPNG is set; svgOriginalPath is the SVG before
+// optimization and sourcePath the raster file of rev.SourceFormat the PNG was
+// decoded from, both may be empty.
+func commitLogoRevision(ctx context.Context, rev *LogoRevision, svgPath, svgOriginalPath, pngPath, sourcePath string) error {
+	// Reserve the revision number first so concurrent uploads cannot share it
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) + 1 FROM logo_revisions WHERE logo_id = ?", rev.LogoID).Scan(&rev.Revision); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO logo_revisions (
+			logo_id, revision, club_name, club_city, club_type, club_website,
+			has_svg, has_png, file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source,
+			background_removed, bbox, aspect_ratio, palette, phash, svg_hash, png_hash, uploaded_by, api_key_id, submission_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rev.LogoID, rev.Revision, rev.ClubName, rev.ClubCity, rev.ClubType, rev.ClubWebsite,
+		boolToInt(rev.HasSVG), boolToInt(rev.HasPNG), rev.FileSizeSVG, rev.FileSizePNG, nullInt64(rev.FileSizeSVGOriginal),
+		nullString(rev.SourceFormat), nullInt64(rev.FileSizeSource), boolToInt(rev.BackgroundRemoved), encodeBounds(rev.Bounds), nullFloat64(rev.AspectRatio),
+		encodePalette(rev.Palette), nullString(rev.PHash), nullString(rev.HashSVG), nullString(rev.HashPNG), rev.UploadedBy, nullString(rev.APIKeyID), nullString(rev.SubmissionID)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// An approved submission records the revision it became together with it
+	if rev.SubmissionID != "" {
+		if _, err := tx.Exec("UPDATE submissions SET revision = ? WHERE id = ?", rev.Revision, rev.SubmissionID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Revision files are written once and never modified
+	for _, master := range []struct {
+		format, path, contentType string
+		present                   bool
+	}{
+		{"svg", svgPath, "image/svg+xml", rev.HasSVG},
+		{"original.svg", svgOriginalPath, "image/svg+xml", rev.HasSVG && svgOriginalPath != ""},
+		{"png", pngPath, "image/png", rev.HasPNG},
+		{sourceKeyFormat(rev.SourceFormat), sourcePath, rasterSourceFormats[rev.SourceFormat].ContentType, rev.SourceFormat != "" && sourcePath != ""},
+	} {
+		if !master.present {
+			continue
+		}
+		if err := putFile(ctx, revisionKey(rev.LogoID, rev.Revision, master.format), master.path, master.contentType); err != nil {
+			db.Exec("DELETE FROM logo_revisions WHERE logo_id = ? AND revision = ?", rev.LogoID, rev.Revision)
+			return fmt.Errorf("store revision %s: %w", master.format, err)
+		}
+	}
+
+	return promoteLogoRevision(ctx, rev)
+}
+
+// promoteLogoRevision copies a revision's files over the current masters and
+// replaces the logo metadata (including the uploader's key) with the
+// revision's metadata
+func promoteLogoRevision(ctx context.Context, rev *LogoRevision) error {
+	for _, master := range []struct {
+		format, contentType string
+		present             bool
+	}{
+		{"svg", "image/svg+xml", rev.HasSVG},
+		{"png", "image/png", rev.HasPNG},
+	} {
+		// Drop a stale master of a format the revision does not have
+		if !master.present {
+			store.Delete(ctx, logoKey(master.format, rev.LogoID))
+			continue
+		}
+		data, _, err := readObject(ctx, revisionKey(rev.LogoID, rev.Revision, master.format))
+		if err != nil {
+			return fmt.Errorf("read revision %s: %w", master.format, err)
+		}
+		if err := store.Put(ctx, logoKey(master.format, rev.LogoID), bytes.NewReader(data), int64(len(data)), master.contentType); err != nil {
+			return fmt.Errorf("store %s: %w", master.format, err)
+		}
+	}
+
+	// Previously generated size variants belong to the old files
+	clearLogoVariants(ctx, rev.LogoID)
+	clearDerivedLogos(ctx, rev.LogoID)
+
+	_, err := db.Exec(`
+		INSERT INTO logos (
+			id, club_name, club_city, club_type, club_website,
+			has_svg, has_png, primary_format,
+			file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source, background_removed,
+			bbox, aspect_ratio, palette, phash, svg_hash, png_hash, current_revision, api_key_id, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, 'png', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			club_name = excluded.club_name,
+			club_city = excluded.club_city,
+			club_type = excluded.club_type,
+			club_website = excluded.club_website,
+			has_svg = excluded.has_svg,
+			has_png = excluded.has_png,
+			file_size_svg = excluded.file_size_svg,
+			file_size_png = excluded.file_size_png,
+			file_size_svg_original = excluded.file_size_svg_original,
+			source_format = excluded.source_format,
+			file_size_source = excluded.file_size_source,
+			background_removed = excluded.background_removed,
+			bbox = excluded.bbox,
+			aspect_ratio = excluded.aspect_ratio,
+			palette = excluded.palette,
+			phash = excluded.phash,
+			svg_hash = excluded.svg_hash,
+			png_hash = excluded.png_hash,
+			current_revision = excluded.current_revision,
+			api_key_id = excluded.api_key_id,
+			updated_at = CURRENT_TIMESTAMP
+	`, rev.LogoID, rev.ClubName, rev.ClubCity, rev.ClubType, rev.ClubWebsite,
+		boolToInt(rev.HasSVG), boolToInt(rev.HasPNG), rev.FileSizeSVG, rev.FileSizePNG, nullInt64(rev.FileSizeSVGOriginal),
+		nullString(rev.SourceFormat), nullInt64(rev.FileSizeSource), boolToInt(rev.BackgroundRemoved),
+		encodeBounds(rev.Bounds), nullFloat64(rev.AspectRatio), encodePalette(rev.Palette), nullString(rev.PHash),
+		nullString(rev.HashSVG), nullString(rev.HashPNG), rev.Revision, nullString(rev.APIKeyID))
+	if err != nil {
+		return err
+	}
+
+	if err := indexLogo(rev.LogoID); err != nil {
+		log.Printf("Warning: Failed to index logo %s: %v", rev.LogoID, err)
+	}
+	if err := indexLogoColors(rev.LogoID); err != nil {
+		log.Printf("Warning: Failed to index colours of logo %s: %v", rev.LogoID, err)
+	}
+	return nil
+}
+
+// backfillLogoRevisions records the current files of logos uploaded before
+// revisions were tracked as their first revision
+func backfillLogoRevisions(ctx context.Context) error {
+	rows, err := db.Query(`
+		SELECT id, club_name, club_city, club_type, club_website,
+		       has_svg, has_png, file_size_svg, file_size_png, svg_hash, png_hash
+		FROM logos WHERE current_revision IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	var pending []LogoRevision
+	for rows.Next() {
+		var rev LogoRevision
+		var clubCity, clubType, clubWebsite, hashSVG, hashPNG sql.NullString
+		var sizeSVG, sizePNG sql.NullInt64
+		var hasSVG, hasPNG int
+		if err := rows.Scan(&rev.LogoID, &rev.ClubName, &clubCity, &clubType, &clubWebsite,
+			&hasSVG, &hasPNG, &sizeSVG, &sizePNG, &hashSVG, &hashPNG); err != nil {
+			continue
+		}
+		rev.ClubCity, rev.ClubType, rev.ClubWebsite = clubCity.String, clubType.String, clubWebsite.String
+		rev.HasSVG, rev.HasPNG = hasSVG == 1, hasPNG == 1
+		rev.FileSizeSVG, rev.FileSizePNG = sizeSVG.Int64, sizePNG.Int64
+		rev.HashSVG, rev.HashPNG = hashSVG.String, hashPNG.String
+		pending = append(pending, rev)
+	}
+	rows.Close()
+
+	recorded := 0
+pendingLoop:
+	for _, rev := range pending {
+		rev.Revision = 1
+		for _, format := range []string{"svg", "png"} {
+			if (format == "svg" && !rev.HasSVG) || (format == "png" && !rev.HasPNG) {
+				continue
+			}
+			data, info, err := readObject(ctx, logoKey(format, rev.LogoID))
+			if err != nil {
+				log.Printf("Warning: Cannot record revision of %s, %s file unreadable: %v", rev.LogoID, format, err)
+				continue pendingLoop
+			}
+			if err := store.Put(ctx, revisionKey(rev.LogoID, 1, format), bytes.NewReader(data), info.Size, ""); err != nil {
+				return err
+			}
+		}
+		if _, err := db.Exec(`
+			INSERT OR IGNORE INTO logo_revisions (
+				logo_id, revision, club_name, club_city, club_type, club_website,
+				has_svg, has_png, file_size_svg, file_size_png, svg_hash, png_hash, uploaded_by
+			) VALUES (?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'import')
+		`, rev.LogoID, rev.ClubName, rev.ClubCity, rev.ClubType, rev.ClubWebsite,
+			boolToInt(rev.HasSVG), boolToInt(rev.HasPNG), rev.FileSizeSVG, rev.FileSizePNG,
+			nullString(rev.HashSVG), nullString(rev.HashPNG)); err != nil {
+			return err
+		}
+		if _, err := db.Exec("UPDATE logos SET current_revision = 1 WHERE id = ?", rev.LogoID); err != nil {
+			return err
+		}
+		recorded++
+	}
+	if recorded > 0 {
+		log.Printf("✓ Recorded %d existing logos as revision 1", recorded)
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// nullString maps an empty string to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullInt64 maps zero to NULL
+func nullInt64(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
+
+// nullFloat64 maps zero to NULL
+func nullFloat64(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: f != 0}
+}
+
+// ==================== Revision Handlers ====================
+
+// parseRevisionParams validates the :id and :rev route parameters
+func parseRevisionParams(c *gin.Context) (string, int, bool) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return "", 0, false
+	}
+	revision, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || revision < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return "", 0, false
+	}
+	return id, revision, true
+}
+
+func revisionURLs(c *gin.Context, rev *LogoRevision) {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s/logos/%s/versions/%d", scheme, c.Request.Host, rev.LogoID, rev.Revision)
+	if rev.HasSVG {
+		rev.LogoURLSVG = baseURL + "?format=svg"
+	}
+	if rev.HasPNG {
+		rev.LogoURLPNG = baseURL + "?format=png"
+	}
+	if rev.HasSVG && rev.FileSizeSVGOriginal > 0 {
+		rev.LogoURLSVGOriginal = baseURL + "?format=svg&original=true"
+	}
+	if rev.SourceFormat != "" {
+		rev.LogoURLSource = baseURL + "?original=true"
+	}
+}
+
+func currentRevision(id string) int {
+	var current sql.NullInt64
+	db.QueryRow("SELECT current_revision FROM logos WHERE id = ?", id).Scan(&current)
+	return int(current.Int64)
+}
+
+// listLogoVersions returns all revisions of a logo, newest first
+func listLogoVersions(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+
+	rows, err := db.Query("SELECT "+revisionColumns+" FROM logo_revisions WHERE logo_id = ? ORDER BY revision DESC", id)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer rows.Close()
+
+	current := currentRevision(id)
+	revisions := []*LogoRevision{}
+	for rows.Next() {
+		rev, err := scanLogoRevision(rows)
+		if err != nil {
+			continue
+		}
+		rev.Current = rev.Revision == current
+		revisionURLs(c, rev)
+		revisions = append(revisions, rev)
+	}
+
+	if len(revisions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// getLogoVersionMetadata returns the metadata of a single revision
+func getLogoVersionMetadata(c *gin.Context) {
+	id, revision, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	rev, err := loadLogoRevision(id, revision)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	rev.Current = rev.Revision == currentRevision(id)
+	revisionURLs(c, rev)
+	c.JSON(http.StatusOK, rev)
+}
+
+// getLogoVersion returns a revision's file (PNG preferred, SVG fallback).
+// original=true selects the file as uploaded: the SVG before optimization or
+// the JPEG, WebP or GIF the PNG was decoded from.
+func getLogoVersion(c *gin.Context) {
+	id, revision, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	rev, err := loadLogoRevision(id, revision)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	format := c.Query("format")
+	switch {
+	case c.Query("original") == "true":
+		switch {
+		case rev.HasSVG && rev.FileSizeSVGOriginal > 0 && (format == "" || format == "svg"):
+			serveStoredObject(c, revisionKey(id, revision, "original.svg"), "image/svg+xml", "public, max-age=31536000, immutable")
+		case rev.SourceFormat != "" && (format == "" || format == rev.SourceFormat):
+			serveStoredObject(c, revisionKey(id, revision, sourceKeyFormat(rev.SourceFormat)), rasterSourceFormats[rev.SourceFormat].ContentType, "public, max-age=31536000, immutable")
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "original file not found"})
+		}
+	case rev.HasPNG && (format == "" || format == "png"):
+		serveStoredObject(c, revisionKey(id, revision, "png"), "image/png", "public, max-age=31536000, immutable")
+	case rev.HasSVG && (format == "" || format == "svg"):
+		serveStoredObject(c, revisionKey(id, revision, "svg"), "image/svg+xml", "public, max-age=31536000, immutable")
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+	}
+}
+
+// promoteLogoVersion makes an older revision the current logo again
+func promoteLogoVersion(c *gin.Context) {
+	id, revision, ok := parseRevisionParams(c)
+	if !ok {
+		return
+	}
+
+	rev, err := loadLogoRevision(id, revision)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+
+	if err := promoteLogoRevision(c.Request.Context(), rev); err != nil {
+		log.Printf("Failed to promote revision %d of %s: %v", revision, id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to promote revision"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"id":       id,
+		"revision": revision,
+		"message":  "revision promoted to current logo",
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// logoSearchFTS is set when SQLite was built with FTS5 (-tags sqlite_fts5).
+// Without it the index lives in a plain table searched with LIKE, which
+// still ignores diacritics but does not rank results.
+var logoSearchFTS bool
+
+// logoSearchTable is the table holding one search document per logo
+var logoSearchTable = "logos_fts"
+
+// initLogoSearch creates the full-text index over logo names, cities and
+// aliases, including diacritic-free forms so "plzen" finds "Plzeň".
+func initLogoSearch(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE VIRTUAL TABLE IF NOT EXISTS logos_fts USING fts5(
+			logo_id UNINDEXED,
+			club_name,
+			club_city,
+			aliases,
+			normalized,
+			tokenize = 'unicode61 remove_diacritics 2'
+		)
+	`)
+	if err == nil {
+		// An existing index cannot be used by a binary built without FTS5
+		_, err = db.Exec("SELECT COUNT(*) FROM logos_fts")
+	}
+	if err == nil {
+		logoSearchFTS = true
+		return nil
+	}
+	if !strings.Contains(err.Error(), "no such module") {
+		return err
+	}
+
+	log.Printf("⚠️  ==================================================================")
+	log.Printf("⚠️  SQLite was built WITHOUT FTS5: logo search falls back to LIKE and")
+	log.Printf("⚠️  results are not ranked. Build or run with -tags sqlite_fts5.")
+	log.Printf("⚠️  ==================================================================")
+	logoSearchTable = "logos_search"
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS logos_search (
+			logo_id TEXT PRIMARY KEY,
+			club_name TEXT,
+			club_city TEXT,
+			aliases TEXT,
+			normalized TEXT
+		)
+	`)
+	return err
+}
+
+// normalizeSearchText lowercases s and strips diacritics
+func normalizeSearchText(s string) string {
+	return removeDiacritics(strings.ToLower(s))
+}
+
+// searchTokens splits a query into normalized words
+func searchTokens(q string) []string {
+	return strings.FieldsFunc(normalizeSearchText(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// parseAliases splits a comma or newline separated list of alternative club
+// names, dropping blanks and duplicates
+func parseAliases(s string) []string {
+	var aliases []string
+	seen := map[string]bool{}
+	for _, alias := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || seen[strings.ToLower(alias)] {
+			continue
+		}
+		seen[strings.ToLower(alias)] = true
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// indexLogo replaces the search document of a logo with its current
+// metadata, or removes it when the logo no longer exists
+func indexLogo(id string) error {
+	var name string
+	var city, aliases sql.NullString
+	err := db.QueryRow("SELECT club_name, club_city, club_aliases FROM logos WHERE id = ?", id).Scan(&name, &city, &aliases)
+	if err == sql.ErrNoRows {
+		return unindexLogo(id)
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := insertSearchDocument(tx, id, name, city.String, aliases.String); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertSearchDocument(tx *sql.Tx, id, name, city, aliases string) error {
+	if _, err := tx.Exec("DELETE FROM "+logoSearchTable+" WHERE logo_id = ?", id); err != nil {
+		return err
+	}
+	aliases = strings.Join(parseAliases(aliases), "\n")
+	normalized := normalizeSearchText(strings.Join([]string{name, city, aliases}, " "))
+	_, err := tx.Exec(
+		"INSERT INTO "+logoSearchTable+" (logo_id, club_name, club_city, aliases, normalized) VALUES (?, ?, ?, ?, ?)",
+		id, name, city, aliases, normalized,
+	)
+	return err
+}
+
+// unindexLogo removes a logo from the search index
+func unindexLogo(id string) error {
+	_, err := db.Exec("DELETE FROM "+logoSearchTable+" WHERE logo_id = ?", id)
+	return err
+}
+
+// rebuildLogoSearchIndex indexes all logos from scratch, picking up rows
+// written before the index existed or by older versions
+func rebuildLogoSearchIndex() error {
+	rows, err := db.Query("SELECT id, club_name, club_city, club_aliases FROM logos")
+	if err != nil {
+		return err
+	}
+	type document struct{ id, name, city, aliases string }
+	var docs []document
+	for rows.Next() {
+		var d document
+		var city, aliases sql.NullString
+		if err := rows.Scan(&d.id, &d.name, &city, &aliases); err != nil {
+			rows.Close()
+			return err
+		}
+		d.city, d.aliases = city.String, aliases.String
+		docs = append(docs, d)
+	}
+	rows.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM " + logoSearchTable); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, d := range docs {
+		if err := insertSearchDocument(tx, d.id, d.name, d.city, d.aliases); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// isIDQuery reports whether q looks like (a prefix of) a UUID
+func isIDQuery(q string) bool {
+	if len(q) < 4 {
+		return false
+	}
+	for _, r := range q {
+		if !strings.ContainsRune("0123456789abcdefABCDEF-", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// logoSearchJoin returns a join of the logos table (aliased l) with the
+// search matches for q, exposing a rank column s.rank (lower is better),
+// and the condition selecting matching logos. Logos whose ID starts with q
+// match as well, ranked after text matches.
+func logoSearchJoin(q string) (join, where string, args []interface{}) {
+	tokens := searchTokens(q)
+
+	var matches string
+	if logoSearchFTS {
+		// Every word must match, as a prefix ("ban" finds "Baník")
+		terms := make([]string, 0, len(tokens))
+		for _, t := range tokens {
+			terms = append(terms, `"`+strings.ReplaceAll(t, `"`, `""`)+`"*`)
+		}
+		matches = "SELECT logo_id, bm25(logos_fts, 0, 10, 4, 6, 1) AS rank FROM logos_fts WHERE logos_fts MATCH ?"
+		args = append(args, strings.Join(terms, " "))
+	} else {
+		conds := make([]string, 0, len(tokens))
+		for _, t := range tokens {
+			conds = append(conds, "normalized LIKE ?")
+			args = append(args, "%"+t+"%")
+		}
+		matches = "SELECT logo_id, 0 AS rank FROM logos_search WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(tokens) == 0 {
+		matches = "SELECT NULL AS logo_id, NULL AS rank WHERE 0"
+		args = nil
+	}
+
+	join = fmt.Sprintf(" LEFT JOIN (%s) s ON s.logo_id = l.id", matches)
+	where = "s.logo_id IS NOT NULL"
+	if isIDQuery(q) {
+		where = "(s.logo_id IS NOT NULL OR l.id LIKE ?)"
+		args = append(args, strings.ToLower(q)+"%")
+	}
+	return join, where, args
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	xdraw "golang.org/x/image/draw"
+)
+
+// Hamming distances (out of 64 bits) between perceptual hashes. Uploads warn
+// about logos within duplicateHashDistance; GET /logos/:id/similar lists
+// logos within max_distance.
+const (
+	duplicateHashDistance  = 6
+	defaultSimilarDistance = 12
+	maxSimilarDistance     = 32
+	defaultSimilarLimit    = 20
+	maxDuplicateWarnings   = 5
+)
+
+// SimilarLogo is a logo that looks like another one
+type SimilarLogo struct {
+	ID       string `json:"id"`
+	ClubName string `json:"club_name"`
+	Distance int    `json:"distance"`
+	LogoURL  string `json:"logo_url,omitempty"`
+}
+
+// PerceptualHash computes a 64-bit difference hash (dHash): the image is
+// flattened onto white, scaled to 9x8 grey pixels and each bit tells whether
+// a pixel is darker than its right neighbour. Visually similar logos get
+// hashes that differ in few bits, regardless of size and encoding.
+func PerceptualHash(img image.Image) string {
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	xdraw.CatmullRom.Scale(small, small.Bounds(), flat, flat.Bounds(), xdraw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y < small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// hashDistance is the number of differing bits of two perceptual hashes, -1
+// when either is not a valid hash
+func hashDistance(a, b string) int {
+	x, errA := strconv.ParseUint(a, 16, 64)
+	y, errB := strconv.ParseUint(b, 16, 64)
+	if errA != nil || errB != nil || len(a) != 16 || len(b) != 16 {
+		return -1
+	}
+	return bits.OnesCount64(x ^ y)
+}
+
+// findSimilarLogos returns the logos other than excludeID whose PNG hash is
+// within maxDistance of hash, closest first. Hashes are compared in Go; the
+// table is small enough to scan.
+func findSimilarLogos(hash, excludeID string, maxDistance, limit int) ([]SimilarLogo, error) {
+	rows, err := db.Query("SELECT id, club_name, phash FROM logos WHERE phash IS NOT NULL AND phash != '' AND id != ?", excludeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	similar := []SimilarLogo{}
+	for rows.Next() {
+		var s SimilarLogo
+		var other string
+		if err := rows.Scan(&s.ID, &s.ClubName, &other); err != nil {
+			return nil, err
+		}
+		if s.Distance = hashDistance(hash, other); s.Distance >= 0 && s.Distance <= maxDistance {
+			similar = append(similar, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Distance != similar[j].Distance {
+			return similar[i].Distance < similar[j].Distance
+		}
+		return similar[i].ClubName < similar[j].ClubName
+	})
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
+
+// duplicateWarnings describes near-duplicates found for an upload
+func duplicateWarnings(duplicates []SimilarLogo) []string {
+	var warnings []string
+	for _, d := range duplicates {
+		warnings = append(warnings, fmt.Sprintf("looks like the logo of %s (%s), distance %d", d.ClubName, d.ID, d.Distance))
+	}
+	return warnings
+}
+
+// phashBackfill hashes the PNGs of logos stored before perceptual hashes
+// were tracked; see backfillLogoPNGs. Unreadable PNGs get an empty hash.
+var phashBackfill = pngBackfill{
+	column: "phash",
+	label:  "perceptual hashes",
+	value: func(img image.Image) (interface{}, interface{}) {
+		if img == nil {
+			return "", nil
+		}
+		return PerceptualHash(img), nil
+	},
+}
+
+// ==================== Similarity Handlers ====================
+
+// getSimilarLogos lists logos that look like the given one, e.g. the same
+// crest uploaded for an A-team and a B-team club
+func getSimilarLogos(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+	maxDistance := defaultSimilarDistance
+	if v := c.Query("max_distance"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 || d > maxSimilarDistance {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_distance must be between 0 and %d", maxSimilarDistance)})
+			return
+		}
+		maxDistance = d
+	}
+	limit := defaultSimilarLimit
+	if v := c.Query("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = min(l, maxPageSize)
+	}
+
+	var hash sql.NullString
+	err := db.QueryRow("SELECT phash FROM logos WHERE id = ?", id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !hash.Valid || hash.String == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "logo has no PNG to compare"})
+		return
+	}
+
+	similar, err := findSimilarLogos(hash.String, id, maxDistance, limit)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	baseURL := requestBaseURL(c)
+	for i := range similar {
+		similar[i].LogoURL = fmt.Sprintf("%s/logos/%s", baseURL, similar[i].ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           id,
+		"phash":        hash.String,
+		"max_distance": maxDistance,
+		"items":        similar,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// allowedLogoSizes bounds the sizes clients may request, which keeps the
+// variant cache from growing without limit.
+var allowedLogoSizes = []int{16, 24, 32, 48, 64, 96, 128, 192, 256, 384, 512, 1024}
+
+func isAllowedLogoSize(n int) bool {
+	for _, s := range allowedLogoSizes {
+		if s == n {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLogoSize reads the size, w and h query parameters. size=N is a
+// shorthand for a square N x N box; w or h alone constrain one side only.
+// Zero values mean no resizing was requested.
+func parseLogoSize(c *gin.Context) (int, int, error) {
+	parse := func(name string) (int, error) {
+		v := c.Query(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || !isAllowedLogoSize(n) {
+			return 0, fmt.Errorf("unsupported %s %q", name, v)
+		}
+		return n, nil
+	}
+
+	size, err := parse("size")
+	if err != nil {
+		return 0, 0, err
+	}
+	w, err := parse("w")
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := parse("h")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if size > 0 {
+		if w == 0 {
+			w = size
+		}
+		if h == 0 {
+			h = size
+		}
+	}
+	return w, h, nil
+}
+
+// logoVariantVersion is bumped when variants are rendered differently, so
+// files cached by older versions are not served
+const logoVariantVersion = 2
+
+func logoVariantKey(id string, width, height int, ext string) string {
+	return fmt.Sprintf("cache/%s/v%d/%dx%d%s", id, logoVariantVersion, width, height, ext)
+}
+
+// ensureLogoVariant returns the storage key of a PNG of the logo resized to
+// fit the requested box, generating it when missing or older than its source.
+// The SVG is rendered and normalized like the PNG master when available;
+// otherwise the PNG master is resampled.
+func ensureLogoVariant(ctx context.Context, id string, width, height int) (string, error) {
+	srcKey := logoKey("svg", id)
+	srcInfo, err := store.Stat(ctx, srcKey)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		srcKey = logoKey("png", id)
+		if srcInfo, err = store.Stat(ctx, srcKey); err != nil {
+			return "", err
+		}
+	}
+
+	variantKey := logoVariantKey(id, width, height, ".png")
+	if info, err := store.Stat(ctx, variantKey); err == nil && !info.ModTime.Before(srcInfo.ModTime) {
+		return variantKey, nil
+	}
+
+	data, _, err := readObject(ctx, srcKey)
+	if err != nil {
+		return "", err
+	}
+
+	var img image.Image
+	if strings.HasPrefix(srcKey, "svg/") {
+		img, err = renderSVGVariant(ctx, id, data, width, height)
+	} else {
+		var master image.Image
+		if master, err = png.Decode(bytes.NewReader(data)); err == nil {
+			img = ResizeImage(master, width, height)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("render variant: %w", err)
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return "", fmt.Errorf("encode variant: %w", err)
+	}
+	if err := store.Put(ctx, variantKey, &buf, int64(buf.Len()), "image/png"); err != nil {
+		return "", err
+	}
+
+	return variantKey, nil
+}
+
+// renderSVGVariant renders the SVG of a logo trimmed and centred on a square
+// canvas fitting the box, with the padding of its PNG master (see
+// NormalizeLogo), so variants line up like the master does
+func renderSVGVariant(ctx context.Context, id string, svg []byte, width, height int) (image.Image, error) {
+	side := width
+	if side == 0 || (height > 0 && height < side) {
+		side = height
+	}
+	padding := logoPadding()
+	if data, _, err := readObject(ctx, logoKey("png", id)); err == nil {
+		if master, err := png.Decode(bytes.NewReader(data)); err == nil {
+			if p, ok := masterPadding(master); ok {
+				padding = p
+			}
+		}
+	}
+
+	renderWidth := 2 * side
+	img, err := renderSVG(bytes.NewReader(svg), renderWidth, renderWidth)
+	if err != nil {
+		return nil, err
+	}
+	if larger := vectorRenderWidth(img, renderWidth, side, padding); larger > 0 {
+		if img, err = renderSVG(bytes.NewReader(svg), larger, larger); err != nil {
+			return nil, err
+		}
+	}
+	normalized, norm := NormalizeLogo(img, side, padding)
+	if norm.Bounds == nil {
+		// Nothing visible to centre
+		return ResizeImage(img, side, side), nil
+	}
+	return normalized, nil
+}
+
+// clearLogoVariants drops all cached variants of a logo
+func clearLogoVariants(ctx context.Context, id string) {
+	objects, err := store.List(ctx, "cache/"+id+"/")
+	if err != nil {
+		log.Printf("Warning: Failed to list variants of %s: %v", id, err)
+		return
+	}
+	for _, obj := range objects {
+		store.Delete(ctx, obj.Key)
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,43 +25,112 @@ func main() {
 	}
 	defer db.Close()
 
-	// Create logos directory if it doesn't exist
-	if err := os.MkdirAll("./logos", 0755); err != nil {
-		log.Fatal("Failed to create logos directory:", err)
+	// Administrative subcommands (e.g. "keys create") run instead of the server
+	if len(os.Args) > 1 {
+		code := runCLI(os.Args[1:])
+		db.Close()
+		os.Exit(code)
 	}
 
-	// Create subdirectories for SVG and PNG
-	if err := os.MkdirAll("./logos/svg", 0755); err != nil {
-		log.Fatal("Failed to create logos/svg directory:", err)
+	// Initialize logo storage (local filesystem or S3-compatible)
+	store, err = newStorageFromEnv()
+	if err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// AVIF and WebP are served only when their encoder works
+	probeDerivedFormats()
+
+	// Club search and lookups go to FAČR API and fotbal.cz (CLUB_SOURCES),
+	// rate limited and retried per host
+	upstream, err = newUpstreamClientFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure upstream requests:", err)
 	}
-	if err := os.MkdirAll("./logos/png", 0755); err != nil {
-		log.Fatal("Failed to create logos/png directory:", err)
+	clubSource, err = newClubSourceFromEnv(upstream)
+	if err != nil {
+		log.Fatal("Failed to configure club sources:", err)
+	}
+	clubCache, err = newClubCacheFromEnv(clubSource)
+	if err != nil {
+		log.Fatal("Failed to configure the club cache:", err)
+	}
+
+	if err := backfillLogoHashes(context.Background()); err != nil {
+		log.Printf("Warning: Failed to compute logo content hashes: %v", err)
+	}
+	if err := backfillLogoRevisions(context.Background()); err != nil {
+		log.Printf("Warning: Failed to record existing logos as revisions: %v", err)
+	}
+	if err := rebuildLogoSearchIndex(); err != nil {
+		log.Printf("Warning: Failed to build the logo search index: %v", err)
+	}
+	// Bounds, palettes and perceptual hashes of older PNGs are filled in
+	// while the server already answers
+	go func() {
+		if err := backfillLogoPNGs(context.Background()); err != nil {
+			log.Printf("Warning: Failed to backfill logo PNG metadata: %v", err)
+		}
+	}()
+
+	// Process uploads in the background, resuming jobs cut off by a restart
+	if err := recoverJobs(); err != nil {
+		log.Printf("Warning: Failed to requeue interrupted jobs: %v", err)
+	}
+	startJobWorkers(context.Background())
+	if err := startClubSync(context.Background()); err != nil {
+		log.Printf("Warning: Club directory sync disabled: %v", err)
 	}
 
 	// Initialize Gin router with larger request size limit (32MB)
 	r := gin.Default()
 	r.MaxMultipartMemory = 32 << 20 // 32 MB
 
-	// CORS middleware - Allow all origins, methods, and headers
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
+	// X-Forwarded-For is only believed from the proxies in TRUSTED_PROXIES
+	trustedProxies = splitEnvList("TRUSTED_PROXIES")
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// CORS middleware - origins from CORS_ALLOWED_ORIGINS (comma-separated),
+	// "*" for any origin. Unset, browsers may only call the API from its own
+	// origin (the bundled frontend proxies /api).
+	corsOrigins, anyOrigin := allowedCORSOrigins()
+	corsConfig := cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH", "HEAD"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Range", "Accept-Language", "Accept-Encoding", "Cache-Control", "Pragma", "If-Modified-Since"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Requested-With", "Range", "Accept-Language", "Accept-Encoding", "Cache-Control", "Pragma", "If-Modified-Since", "If-None-Match"},
 		ExposeHeaders:    []string{"*"},
 		AllowCredentials: false,
-		AllowOriginFunc:  func(origin string) bool { return true },
-	}))
+	}
+	switch {
+	case anyOrigin:
+		corsConfig.AllowAllOrigins = true
+		r.Use(cors.New(corsConfig))
+		log.Printf("🌐 CORS: any origin")
+	case len(corsOrigins) > 0:
+		corsConfig.AllowOrigins = corsOrigins
+		r.Use(cors.New(corsConfig))
+		log.Printf("🌐 CORS: %s", strings.Join(corsOrigins, ", "))
+	default:
+		log.Printf("🌐 CORS: no cross-origin access, set CORS_ALLOWED_ORIGINS to allow origins")
+	}
 
 	// Routes
 	setupRoutes(r)
 
 	// Global preflight handler for any path
 	r.OPTIONS("/*path", func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		origin := c.GetHeader("Origin")
+		if anyOrigin {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if containsString(corsOrigins, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH, HEAD")
 		reqHeaders := c.GetHeader("Access-Control-Request-Headers")
 		if reqHeaders == "" {
-			reqHeaders = "Origin, Content-Type, Accept, Authorization, X-Requested-With, Range, Accept-Language, Accept-Encoding, Cache-Control, Pragma, If-Modified-Since"
+			reqHeaders = "Origin, Content-Type, Accept, Authorization, X-API-Key, X-Requested-With, Range, Accept-Language, Accept-Encoding, Cache-Control, Pragma, If-Modified-Since, If-None-Match"
 		}
 		c.Header("Access-Control-Allow-Headers", reqHeaders)
 		c.Status(http.StatusNoContent)
@@ -71,7 +143,6 @@ func main() {
 	}
 
 	log.Printf("🚀 Server starting on port %s", port)
-	log.Printf("📁 Logos directory: ./logos")
 	log.Printf("💾 Database: ./data/db.sqlite")
 
 	if err := r.Run(":" + port); err != nil {
@@ -80,12 +151,10 @@ func main() {
 }
 
 func setupRoutes(r *gin.Engine) {
-	// Health check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	// Health check, including the upstream circuit breakers
+	r.GET("/health", healthCheck)
 
-	// Club routes (proxy to FAČR API)
+	// Club routes (local directory, then FAČR)
 	clubs := r.Group("/clubs")
 	{
 		clubs.GET("/search", searchClubs)
@@ -96,11 +165,93 @@ func setupRoutes(r *gin.Engine) {
 	logos := r.Group("/logos")
 	{
 		logos.GET("", listLogos)
+		logos.POST("/search-by-image", searchLogosByImage)
+		logos.POST("/bulk", requireRole(RoleContributor), uploadLogoBulk)
+		logos.GET("/bulk/:batch", getBulkUpload)
 		logos.GET("/:id", getLogo)
 		logos.GET("/:id/json", getLogoWithMetadata)
-		logos.POST("/:id", uploadLogo)
-		logos.DELETE("/:id", deleteLogo)
+		logos.GET("/:id/similar", getSimilarLogos)
+		logos.GET("/:id/:file", getLogoByHash)
+		logos.POST("/:id", requireRole(RoleContributor), uploadLogo)
+		logos.POST("/:id/import", requireRole(RoleContributor), importLogo)
+		logos.DELETE("/:id", requireRole(RoleAdmin), deleteLogo)
+		logos.PUT("/:id/colors", requireRole(RoleAdmin), setLogoColors)
+
+		// Revision history
+		logos.GET("/:id/versions", listLogoVersions)
+		logos.GET("/:id/versions/:rev", getLogoVersion)
+		logos.GET("/:id/versions/:rev/json", getLogoVersionMetadata)
+		logos.POST("/:id/versions/:rev/promote", requireRole(RoleAdmin), promoteLogoVersion)
+
+		// Community submissions go to the moderation queue
+		logos.POST("/:id/submissions", submissionLimiter.limit, createSubmission)
+	}
+
+	// Tools
+	r.POST("/tools/remove-background", requireRole(RoleContributor), previewBackgroundRemoval)
+
+	// Logo coverage of the club directory
+	r.GET("/coverage", getCoverage)
+
+	// Background job status
+	r.GET("/jobs/:id", requireRole(RoleReader), getJob)
+
+	// Submission status and files
+	submissions := r.Group("/submissions")
+	{
+		submissions.GET("/:sid", getSubmission)
+		submissions.GET("/:sid/file", getSubmissionFile)
+	}
+
+	// Admin routes
+	admin := r.Group("/admin", requireRole(RoleAdmin))
+	{
+		admin.GET("/keys", listAPIKeysHandler)
+		admin.POST("/keys", createAPIKeyHandler)
+		admin.DELETE("/keys/:id", revokeAPIKeyHandler)
+
+		// Club directory sync
+		admin.GET("/clubs/sync", getClubDirectoryStatus)
+		admin.POST("/clubs/sync", startClubSyncHandler)
+
+		// Moderation queue
+		admin.GET("/submissions", listSubmissions)
+		admin.GET("/submissions/:sid", reviewSubmission)
+		admin.POST("/submissions/:sid/approve", approveSubmission)
+		admin.POST("/submissions/:sid/reject", rejectSubmission)
+	}
+}
+
+// allowedCORSOrigins parses CORS_ALLOWED_ORIGINS; "*" allows any origin,
+// an empty list none
+func allowedCORSOrigins() (origins []string, any bool) {
+	for _, origin := range splitEnvList("CORS_ALLOWED_ORIGINS") {
+		if origin == "*" {
+			return nil, true
+		}
+		origins = append(origins, origin)
+	}
+	return origins, false
+}
+
+// splitEnvList reads a comma-separated list from the environment, nil when unset
+func splitEnvList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
 	}
+	return false
 }
 
 func initDB() (*sql.DB, error) {
@@ -109,7 +260,9 @@ func initDB() (*sql.DB, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", "./data/db.sqlite")
+	// Job workers write concurrently with requests; wait for locks instead
+	// of failing with "database is locked"
+	db, err := sql.Open("sqlite3", "./data/db.sqlite?_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
@@ -135,6 +288,281 @@ func initDB() (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Columns added after the initial schema
+	if err := ensureColumns(db, "logos", [][2]string{
+		{"png_hash", "TEXT"},
+		{"svg_hash", "TEXT"},
+		{"current_revision", "INTEGER"},
+		{"api_key_id", "TEXT"},
+		{"file_size_svg_original", "INTEGER"},
+		{"source_format", "TEXT"},
+		{"file_size_source", "INTEGER"},
+		{"background_removed", "INTEGER DEFAULT 0"},
+		{"bbox", "TEXT"},
+		{"aspect_ratio", "REAL"},
+		{"palette", "TEXT"},
+		{"club_colors", "TEXT"},
+		{"phash", "TEXT"},
+		{"club_aliases", "TEXT"},
+	}); err != nil {
+		return nil, err
+	}
+
+	// Colours of each logo for colour filtering, see indexLogoColors
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS logo_colors (
+			logo_id TEXT NOT NULL,
+			hex TEXT NOT NULL,
+			weight REAL NOT NULL,
+			lab_l REAL NOT NULL,
+			lab_a REAL NOT NULL,
+			lab_b REAL NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_logo_colors_logo ON logo_colors(logo_id)"); err != nil {
+		return nil, err
+	}
+
+	// Full-text search over names, cities and aliases
+	if err := initLogoSearch(db); err != nil {
+		return nil, err
+	}
+
+	// Every upload is kept as an immutable revision
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS logo_revisions (
+			logo_id TEXT NOT NULL,
+			revision INTEGER NOT NULL,
+			club_name TEXT NOT NULL,
+			club_city TEXT,
+			club_type TEXT,
+			club_website TEXT,
+			has_svg INTEGER DEFAULT 0,
+			has_png INTEGER DEFAULT 0,
+			file_size_svg INTEGER,
+			file_size_png INTEGER,
+			svg_hash TEXT,
+			png_hash TEXT,
+			uploaded_by TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (logo_id, revision)
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureColumns(db, "logo_revisions", [][2]string{
+		{"api_key_id", "TEXT"},
+		{"submission_id", "TEXT"},
+		{"file_size_svg_original", "INTEGER"},
+		{"source_format", "TEXT"},
+		{"file_size_source", "INTEGER"},
+		{"background_removed", "INTEGER DEFAULT 0"},
+		{"bbox", "TEXT"},
+		{"aspect_ratio", "REAL"},
+		{"palette", "TEXT"},
+		{"phash", "TEXT"},
+	}); err != nil {
+		return nil, err
+	}
+
+	// API keys for write endpoints; only a hash of each key is stored
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL,
+			key_prefix TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME,
+			revoked_at DATETIME
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Community submissions waiting for (or after) moderation
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS submissions (
+			id TEXT PRIMARY KEY,
+			logo_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			club_name TEXT NOT NULL,
+			club_city TEXT,
+			club_type TEXT,
+			club_website TEXT,
+			has_svg INTEGER DEFAULT 0,
+			has_png INTEGER DEFAULT 0,
+			file_size_svg INTEGER,
+			file_size_png INTEGER,
+			svg_hash TEXT,
+			png_hash TEXT,
+			submitter_name TEXT,
+			submitter_email TEXT,
+			submitter_ip TEXT,
+			reviewer_notes TEXT,
+			reviewed_by TEXT,
+			reviewer_key_id TEXT,
+			reviewed_at DATETIME,
+			revision INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureColumns(db, "submissions", [][2]string{
+		{"file_size_svg_original", "INTEGER"},
+		{"source_format", "TEXT"},
+		{"file_size_source", "INTEGER"},
+		{"background_removed", "INTEGER DEFAULT 0"},
+		{"bbox", "TEXT"},
+		{"aspect_ratio", "REAL"},
+		{"palette", "TEXT"},
+		{"phash", "TEXT"},
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_submissions_status ON submissions(status, created_at)"); err != nil {
+		return nil, err
+	}
+
+	// Background jobs (logo conversions); see jobs.go
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			logo_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempts INTEGER DEFAULT 0,
+			max_attempts INTEGER DEFAULT 3,
+			error TEXT,
+			result TEXT,
+			payload BLOB,
+			run_after DATETIME DEFAULT CURRENT_TIMESTAMP,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			started_at DATETIME,
+			finished_at DATETIME
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, run_after)"); err != nil {
+		return nil, err
+	}
+	if err := ensureColumns(db, "jobs", [][2]string{
+		{"lock_key", "TEXT"},
+	}); err != nil {
+		return nil, err
+	}
+	// Jobs queued before lock keys lock on their logo; club syncs used to
+	// store their key as the logo ID
+	if _, err := db.Exec("UPDATE jobs SET lock_key = ?, logo_id = '' WHERE kind = ? AND logo_id = ?",
+		clubSyncJobKey, JobKindClubSync, clubSyncJobKey); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE jobs SET lock_key = logo_id WHERE lock_key IS NULL AND logo_id != ''"); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_jobs_lock ON jobs(lock_key, status)"); err != nil {
+		return nil, err
+	}
+
+	// ZIP uploads and the jobs of their files; see bulk_upload.go
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bulk_uploads (
+			id TEXT PRIMARY KEY,
+			files TEXT NOT NULL,
+			warnings TEXT,
+			uploaded_by TEXT,
+			api_key_id TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local club directory and the queries that keep it in sync; see
+	// club_directory.go
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS clubs (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			type TEXT,
+			address TEXT,
+			city TEXT,
+			logo_url TEXT,
+			search_text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			synced_at DATETIME
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS club_sync_queries (
+			query TEXT PRIMARY KEY,
+			synced_at DATETIME,
+			results INTEGER
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upstream club records and search results; see club_cache.go
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS club_cache (
+			key TEXT PRIMARY KEY,
+			data TEXT,
+			miss INTEGER NOT NULL DEFAULT 0,
+			fetched_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Println("✓ Database initialized")
 	return db, nil
 }
+
+// ensureColumns adds the given {name, declaration} columns to a table when
+// they are missing, so databases created by older versions keep working.
+func ensureColumns(db *sql.DB, table string, columns [][2]string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, col := range columns {
+		if existing[col[0]] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col[0], col[1])); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", table, col[0], err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The mock upstream serves a few well-known clubs through both the FAČR API and
+// fotbal.cz-like pages, so club lookups can run without network access:
+//
+//	server mock-upstream -addr :9090
+//	CLUB_SOURCES=fotbal,facr FACR_API_URL=http://localhost:9090 \
+//	FOTBAL_CZ_URL=http://localhost:9090 FOTBAL_CZ_MEDIA_URL=http://localhost:9090 server
+
+var mockSearchPage = template.Must(template.New("search").Funcs(mockTemplateFuncs).Parse(`<!DOCTYPE html>
+<html><body><ul>
+{{range .}}<li class="ListItemSplit">
+<a class="Link--inverted" href="/{{if eq .Type "futsal"}}futsal{{else}}souteze{{end}}/club/club/{{.ID}}"><img src="{{.LogoURL}}" alt=""><span class="H7">{{.Name}}</span></a>
+<div class="ClubAddress"><p>{{mockAddress .City}}</p></div>
+</li>
+{{end}}</ul></body></html>
+`))
+
+var mockClubPage = template.Must(template.New("club").Funcs(mockTemplateFuncs).Parse(`<!DOCTYPE html>
+<html><body>
+<h1 class="H4"><span>{{.Name}}</span></h1>
+<div class="ClubAddress"><p>{{mockAddress .City}}</p></div>
+</body></html>
+`))
+
+var mockTemplateFuncs = template.FuncMap{"mockAddress": mockAddress}
+
+// mockAddress formats a city the way fotbal.cz addresses look
+func mockAddress(city string) string {
+	return "Sportovní 1, 10000 " + city
+}
+
+// mockUpstream serves mockClubs. Sources listed in failing answer
+// every request with 503, to try out the fallback between sources.
+type mockUpstream struct {
+	clubs   []Club
+	failing map[string]bool
+}
+
+func (m *mockUpstream) club(id string) (Club, bool) {
+	for _, club := range m.clubs {
+		if club.ID == id {
+			return club, true
+		}
+	}
+	return Club{}, false
+}
+
+// search matches clubs and fills in their logo URLs
+func (m *mockUpstream) search(r *http.Request) []Club {
+	clubs := []Club{}
+	for _, club := range matchMockClubs(r.URL.Query().Get("q")) {
+		club.LogoURL = mockLogoURL(r, club.ID)
+		club.Address = mockAddress(club.City)
+		clubs = append(clubs, club)
+	}
+	return clubs
+}
+
+func mockLogoURL(r *http.Request, id string) string {
+	return fmt.Sprintf("http://%s/media/kluby/%s/%s_crop.jpg", r.Host, id, id)
+}
+
+func (m *mockUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	source := "fotbal"
+	if strings.HasPrefix(r.URL.Path, "/club/") && r.URL.Path != "/club/hledej" {
+		source = "facr"
+	}
+	if m.failing[source] {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	// FAČR API
+	case path == "club/search":
+		var results []FACRSearchResult
+		for _, club := range m.search(r) {
+			results = append(results, FACRSearchResult{
+				Name:     club.Name,
+				ClubID:   club.ID,
+				ClubType: club.Type,
+				URL:      fmt.Sprintf("http://%s/souteze/club/club/%s", r.Host, club.ID),
+				LogoURL:  club.LogoURL,
+				Address:  club.Address,
+			})
+		}
+		writeMockJSON(w, FACRSearchResponse{Query: r.URL.Query().Get("q"), Count: len(results), Results: results})
+	case len(parts) == 3 && parts[0] == "club" && (parts[1] == "football" || parts[1] == "futsal"):
+		club, ok := m.club(parts[2])
+		if !ok || club.Type != parts[1] {
+			http.NotFound(w, r)
+			return
+		}
+		writeMockJSON(w, FACRClubResponse{
+			Name:     club.Name,
+			ClubID:   club.ID,
+			ClubType: club.Type,
+			URL:      fmt.Sprintf("http://%s/souteze/club/club/%s", r.Host, club.ID),
+			LogoURL:  mockLogoURL(r, club.ID),
+			Address:  mockAddress(club.City),
+		})
+
+	// fotbal.cz
+	case path == "club/hledej":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockSearchPage.Execute(w, m.search(r))
+	case len(parts) == 4 && (parts[0] == "souteze" || parts[0] == "futsal") && parts[1] == "club" && parts[2] == "club":
+		club, ok := m.club(parts[3])
+		if !ok || (club.Type == "futsal") != (parts[0] == "futsal") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockClubPage.Execute(w, club)
+	case len(parts) == 4 && parts[0] == "media" && parts[1] == "kluby" && parts[3] == parts[2]+"_crop.jpg":
+		if _, ok := m.club(parts[2]); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		jpeg.Encode(w, mockCrest(parts[2]), &jpeg.Options{Quality: 90})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeMockJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// mockCrest draws a round crest on white in a colour derived from the club ID
+func mockCrest(id string) image.Image {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	sum := h.Sum32()
+	fill := color.RGBA{uint8(sum >> 16), uint8(sum >> 8), uint8(sum), 255}
+
+	const size = 200
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := x-size/2, y-size/2
+			if dx*dx+dy*dy <= 80*80 {
+				img.Set(x, y, fill)
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+// runMockUpstreamCommand serves the mock upstream until interrupted
+func runMockUpstreamCommand(args []string) int {
+	fs := flag.NewFlagSet("mock-upstream", flag.ContinueOnError)
+	addr := fs.String("addr", ":9090", "listen address")
+	fail := fs.String("fail", "", "comma-separated sources answering 503 (facr, fotbal)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	mock := &mockUpstream{clubs: mockClubs, failing: map[string]bool{}}
+	for _, source := range strings.Split(*fail, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			mock.failing[source] = true
+		}
+	}
+	log.Printf("Mock FAČR API and fotbal.cz listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, mock); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// mockClubs are the clubs known to the mock upstream
+var mockClubs = []Club{
+	{
+		ID:      "11111111-2222-3333-4444-555555555555",
+		Name:    "SK Slavia Praha",
+		City:    "Praha",
+		Type:    "football",
+		Website: "https://www.slavia.cz",
+	},
+	{
+		ID:      "22222222-3333-4444-5555-666666666666",
+		Name:    "AC Sparta Praha",
+		City:    "Praha",
+		Type:    "football",
+		Website: "https://www.sparta.cz",
+	},
+	{
+		ID:      "33333333-4444-5555-6666-777777777777",
+		Name:    "FC Viktoria Plzeň",
+		City:    "Plzeň",
+		Type:    "football",
+		Website: "https://www.fcviktoria.cz",
+	},
+	{
+		ID:      "44444444-5555-6666-7777-888888888888",
+		Name:    "FC Baník Ostrava",
+		City:    "Ostrava",
+		Type:    "football",
+		Website: "https://www.fcb.cz",
+	},
+	{
+		ID:      "55555555-6666-7777-8888-999999999999",
+		Name:    "SK Sigma Olomouc",
+		City:    "Olomouc",
+		Type:    "football",
+		Website: "https://www.sigmafotbal.cz",
+	},
+	{
+		ID:      "66666666-7777-8888-9999-aaaaaaaaaaaa",
+		Name:    "FC Slovan Liberec",
+		City:    "Liberec",
+		Type:    "football",
+		Website: "https://www.fcslovanliberec.cz",
+	},
+	{
+		ID:      "77777777-8888-9999-aaaa-bbbbbbbbbbbb",
+		Name:    "MFK Karviná",
+		City:    "Karviná",
+		Type:    "football",
+		Website: "https://www.mfkkarvina.cz",
+	},
+	{
+		ID:      "88888888-9999-aaaa-bbbb-cccccccccccc",
+		Name:    "FC Fastav Zlín",
+		City:    "Zlín",
+		Type:    "football",
+		Website: "https://www.fczlin.cz",
+	},
+	{
+		ID:      "99999999-aaaa-bbbb-cccc-dddddddddddd",
+		Name:    "FK Jablonec",
+		City:    "Jablonec nad Nisou",
+		Type:    "football",
+		Website: "https://www.fkjablonec.cz",
+	},
+	{
+		ID:      "aaaaaaaa-bbbb-cccc-dddd-eeeeeeeeeeee",
+		Name:    "SFC Opava",
+		City:    "Opava",
+		Type:    "football",
+		Website: "https://www.sfcopava.cz",
+	},
+	{
+		ID:      "bbbbbbbb-cccc-dddd-eeee-ffffffffffff",
+		Name:    "FK Teplice",
+		City:    "Teplice",
+		Type:    "football",
+		Website: "https://www.fkteplice.cz",
+	},
+	{
+		ID:      "cccccccc-dddd-eeee-ffff-000000000000",
+		Name:    "1. FK Příbram",
+		City:    "Příbram",
+		Type:    "football",
+		Website: "https://www.1fkpribram.cz",
+	},
+	{
+		ID:      "dddddddd-eeee-ffff-0000-111111111111",
+		Name:    "SK Dynamo České Budějovice",
+		City:    "České Budějovice",
+		Type:    "football",
+		Website: "https://www.dynamocb.cz",
+	},
+	{
+		ID:      "eeeeeeee-ffff-0000-1111-222222222222",
+		Name:    "FC Zbrojovka Brno",
+		City:    "Brno",
+		Type:    "football",
+		Website: "https://www.fczbrno.cz",
+	},
+	{
+		ID:      "ffffffff-0000-1111-2222-333333333333",
+		Name:    "FC Vysočina Jihlava",
+		City:    "Jihlava",
+		Type:    "football",
+		Website: "https://www.fcvysocina.cz",
+	},
+	{
+		ID:      "00000000-1111-2222-3333-444444444444",
+		Name:    "FK Mladá Boleslav",
+		City:    "Mladá Boleslav",
+		Type:    "football",
+		Website: "https://www.fkmb.cz",
+	},
+	{
+		ID:      "10101010-1111-2222-3333-444444444444",
+		Name:    "SK Sigma Hranice",
+		City:    "Hranice",
+		Type:    "football",
+		Website: "",
+	},
+	{
+		ID:      "20202020-2222-3333-4444-555555555555",
+		Name:    "SK Hranice",
+		City:    "Hranice",
+		Type:    "football",
+		Website: "",
+	},
+	{
+		ID:      "30303030-3333-4444-5555-666666666666",
+		Name:    "TJ Krnov",
+		City:    "Krnov",
+		Type:    "football",
+		Website: "",
+	},
+	{
+		ID:   "f0f0f0f0-1111-2222-3333-444444444444",
+		Name: "FK Chrudim",
+		City: "Chrudim",
+		Type: "futsal",
+	},
+}
+
+// matchMockClubs matches the mock clubs against a search query
+func matchMockClubs(query string) []Club {
+	var results []Club
+	lowerQuery := strings.ToLower(query)
+
+	// Fuzzy matching: check contains in name, city, and partial matches
+	for _, club := range mockClubs {
+		lowerName := strings.ToLower(club.Name)
+		lowerCity := strings.ToLower(club.City)
+
+		// Exact contains match in name or city
+		if strings.Contains(lowerName, lowerQuery) || strings.Contains(lowerCity, lowerQuery) {
+			results = append(results, club)
+			continue
+		}
+
+		// Fuzzy match: check if query matches start of any word in name
+		words := strings.Fields(lowerName)
+		for _, word := range words {
+			if strings.HasPrefix(word, lowerQuery) {
+				results = append(results, club)
+				break
+			}
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes for list endpoints
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// LogoPage is one page of GET /logos. Total counts all matching logos;
+// NextCursor is empty on the last page.
+type LogoPage struct {
+	Items      []LogoMetadata `json:"items"`
+	Total      int            `json:"total"`
+	Limit      int            `json:"limit"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// listCursor is the position after the last item of a page. Keyset sorts
+// carry the sort key and ID of that item, so pages stay stable while rows
+// are inserted; relevance ranking, which shifts as the index changes, pages
+// by offset.
+type listCursor struct {
+	Sort   string `json:"s"`
+	Key    string `json:"k,omitempty"`
+	ID     string `json:"i,omitempty"`
+	Offset int    `json:"o,omitempty"`
+}
+
+func (cur listCursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor parses a cursor issued for the given sort order
+func decodeListCursor(s, sort string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cur listCursor
+	if err := json.Unmarshal(data, &cur); err != nil || cur.Sort != sort || cur.Offset < 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cur, nil
+}
+
+// parsePageSize reads the limit query parameter, defaulting to
+// defaultPageSize and capped at maxPageSize
+func parsePageSize(c *gin.Context) (int, error) {
+	v := c.Query("limit")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return limit, nil
+}
+
+// setPageLinks sets a Link header with the first page and, when there is
+// one, the next page of the current request
+func setPageLinks(c *gin.Context, nextCursor string) {
+	link := func(cursor, rel string) string {
+		u := *c.Request.URL
+		q := u.Query()
+		q.Del("page")
+		q.Del("cursor")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf("<%s>; rel=%q", requestBaseURL(c)+u.RequestURI(), rel)
+	}
+
+	header := link("", "first")
+	if nextCursor != "" {
+		header = link(nextCursor, "next") + ", " + header
+	}
+	c.Header("Link", header)
+}
+
+// requestBaseURL returns scheme and host of the current request
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: c.Request.Host}).String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage keeps objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3StorageFromEnv configures S3 storage from S3_ENDPOINT, S3_BUCKET,
+// S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY, S3_REGION, S3_PREFIX and
+// S3_USE_SSL. The bucket is created when it does not exist yet.
+func NewS3StorageFromEnv() (*S3Storage, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	bucket := os.Getenv("S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for S3 storage")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"), ""),
+		Secure: os.Getenv("S3_USE_SSL") != "false",
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: os.Getenv("S3_REGION")}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %w", bucket, err)
+		}
+	}
+
+	prefix := strings.Trim(os.Getenv("S3_PREFIX"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Storage{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+// mapS3Error turns "no such key" responses into fs.ErrNotExist
+func mapS3Error(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if resp := minio.ToErrorResponse(err); resp.Code == "NoSuchKey" || resp.StatusCode == 404 {
+		return &fs.PathError{Op: "s3", Path: key, Err: fs.ErrNotExist}
+	}
+	return err
+}
+
+func (s *S3Storage) objectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         strings.TrimPrefix(info.Key, s.prefix),
+		Size:        info.Size,
+		ModTime:     info.LastModified,
+		ContentType: info.ContentType,
+	}
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, mapS3Error(key, err)
+	}
+	// GetObject is lazy, Stat surfaces missing keys
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, ObjectInfo{}, mapS3Error(key, err)
+	}
+	return obj, s.objectInfo(info), nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, mapS3Error(key, err)
+	}
+	return s.objectInfo(info), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, s.objectInfo(info))
+	}
+	return objects, nil
+}
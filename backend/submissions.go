@@ -0,0 +1,726 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Submission states. A submission is "processing" until its job has
+// stored it, or "failed" when the job could not.
+const (
+	SubmissionProcessing = "processing"
+	SubmissionFailed     = "failed"
+	SubmissionPending    = "pending"
+	SubmissionApproved   = "approved"
+	SubmissionRejected   = "rejected"
+)
+
+// Submission is a community upload waiting for (or after) moderation. Its
+// files live under submissions/<id>/ and do not affect the public logo until
+// an admin approves it.
+type Submission struct {
+	ID                  string                `json:"id"`
+	LogoID              string                `json:"logo_id"`
+	Status              string                `json:"status"`
+	ClubName            string                `json:"club_name"`
+	ClubCity            string                `json:"club_city,omitempty"`
+	ClubType            string                `json:"club_type,omitempty"`
+	ClubWebsite         string                `json:"club_website,omitempty"`
+	HasSVG              bool                  `json:"has_svg"`
+	HasPNG              bool                  `json:"has_png"`
+	FileSizeSVG         int64                 `json:"file_size_svg,omitempty"`
+	FileSizePNG         int64                 `json:"file_size_png,omitempty"`
+	FileSizeSVGOriginal int64                 `json:"file_size_svg_original,omitempty"`
+	SourceFormat        string                `json:"source_format,omitempty"`
+	FileSizeSource      int64                 `json:"file_size_source,omitempty"`
+	BackgroundRemoved   bool                  `json:"background_removed"`
+	Bounds              *LogoBounds           `json:"bbox,omitempty"`
+	AspectRatio         float64               `json:"aspect_ratio,omitempty"`
+	Palette             []PaletteColor        `json:"palette,omitempty"`
+	PHash               string                `json:"phash,omitempty"`
+	HashSVG             string                `json:"hash_svg,omitempty"`
+	HashPNG             string                `json:"hash_png,omitempty"`
+	SubmitterName       string                `json:"submitter_name,omitempty"`
+	SubmitterEmail      string                `json:"submitter_email,omitempty"`
+	SubmitterIP         string                `json:"submitter_ip,omitempty"`
+	ReviewerNotes       string                `json:"reviewer_notes,omitempty"`
+	ReviewedBy          string                `json:"reviewed_by,omitempty"`
+	ReviewerKeyID       string                `json:"reviewer_key_id,omitempty"`
+	ReviewedAt          *time.Time            `json:"reviewed_at,omitempty"`
+	Revision            int                   `json:"revision,omitempty"`
+	LogoURLSVG          string                `json:"logo_url_svg,omitempty"`
+	LogoURLPNG          string                `json:"logo_url_png,omitempty"`
+	Comparison          *SubmissionComparison `json:"comparison,omitempty"`
+	CreatedAt           time.Time             `json:"created_at"`
+}
+
+// ComparedLogo describes one side of a submission comparison
+type ComparedLogo struct {
+	Revision    int    `json:"revision,omitempty"`
+	ClubName    string `json:"club_name"`
+	HasSVG      bool   `json:"has_svg"`
+	HasPNG      bool   `json:"has_png"`
+	FileSizeSVG int64  `json:"file_size_svg,omitempty"`
+	FileSizePNG int64  `json:"file_size_png,omitempty"`
+	HashSVG     string `json:"hash_svg,omitempty"`
+	HashPNG     string `json:"hash_png,omitempty"`
+	WidthPNG    int    `json:"width_png,omitempty"`
+	HeightPNG   int    `json:"height_png,omitempty"`
+	LogoURLSVG  string `json:"logo_url_svg,omitempty"`
+	LogoURLPNG  string `json:"logo_url_png,omitempty"`
+}
+
+// SubmissionComparison puts a submission side by side with the logo it would
+// replace. Current is nil when the club has no logo yet.
+type SubmissionComparison struct {
+	Current         *ComparedLogo        `json:"current"`
+	Submitted       ComparedLogo         `json:"submitted"`
+	SameSVG         bool                 `json:"same_svg"`
+	SamePNG         bool                 `json:"same_png"`
+	MetadataChanges map[string][2]string `json:"metadata_changes,omitempty"`
+	Duplicates      []SimilarLogo        `json:"duplicates,omitempty"`
+}
+
+// Anonymous submissions allowed per client IP: a burst of
+// submissionRateBurst, then one every submissionRateEvery
+const (
+	submissionRateBurst = 5
+	submissionRateEvery = 10 * time.Minute
+)
+
+// submissionLimiter limits anonymous submissions per client IP
+var submissionLimiter = newIPRateLimiter(submissionRateEvery, submissionRateBurst)
+
+// submissionKey returns the storage key of a submitted master file
+func submissionKey(s *Submission, format string) string {
+	return fmt.Sprintf("submissions/%s/%s.%s", s.ID, s.LogoID, format)
+}
+
+const submissionColumns = `id, logo_id, status, club_name, club_city, club_type, club_website,
+	has_svg, has_png, file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source,
+	background_removed, bbox, aspect_ratio, palette, phash, svg_hash, png_hash, submitter_name, submitter_email, submitter_ip,
+	reviewer_notes, reviewed_by, reviewer_key_id, reviewed_at, revision, created_at`
+
+func scanSubmission(row interface{ Scan(...interface{}) error }) (*Submission, error) {
+	var s Submission
+	var clubCity, clubType, clubWebsite, hashSVG, hashPNG, sourceFormat, bounds, palette, phash sql.NullString
+	var submitterName, submitterEmail, submitterIP sql.NullString
+	var notes, reviewedBy, reviewerKeyID sql.NullString
+	var sizeSVG, sizePNG, sizeSVGOriginal, sizeSource, revision sql.NullInt64
+	var aspectRatio sql.NullFloat64
+	var reviewedAt sql.NullTime
+	var hasSVG, hasPNG, backgroundRemoved int
+	if err := row.Scan(
+		&s.ID, &s.LogoID, &s.Status, &s.ClubName, &clubCity, &clubType, &clubWebsite,
+		&hasSVG, &hasPNG, &sizeSVG, &sizePNG, &sizeSVGOriginal, &sourceFormat, &sizeSource, &backgroundRemoved, &bounds, &aspectRatio, &palette, &phash, &hashSVG, &hashPNG,
+		&submitterName, &submitterEmail, &submitterIP,
+		&notes, &reviewedBy, &reviewerKeyID, &reviewedAt, &revision, &s.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	s.ClubCity, s.ClubType, s.ClubWebsite = clubCity.String, clubType.String, clubWebsite.String
+	s.HasSVG, s.HasPNG = hasSVG == 1, hasPNG == 1
+	s.FileSizeSVG, s.FileSizePNG, s.FileSizeSVGOriginal = sizeSVG.Int64, sizePNG.Int64, sizeSVGOriginal.Int64
+	s.SourceFormat, s.FileSizeSource = sourceFormat.String, sizeSource.Int64
+	s.BackgroundRemoved = backgroundRemoved == 1
+	s.Bounds, s.AspectRatio = decodeBounds(bounds), aspectRatio.Float64
+	s.Palette, s.PHash = decodePalette(palette), phash.String
+	s.HashSVG, s.HashPNG = hashSVG.String, hashPNG.String
+	s.SubmitterName, s.SubmitterEmail, s.SubmitterIP = submitterName.String, submitterEmail.String, submitterIP.String
+	s.ReviewerNotes, s.ReviewedBy, s.ReviewerKeyID = notes.String, reviewedBy.String, reviewerKeyID.String
+	if reviewedAt.Valid {
+		s.ReviewedAt = &reviewedAt.Time
+	}
+	s.Revision = int(revision.Int64)
+	return &s, nil
+}
+
+func loadSubmission(id string) (*Submission, error) {
+	return scanSubmission(db.QueryRow("SELECT "+submissionColumns+" FROM submissions WHERE id = ?", id))
+}
+
+// submissionURLs fills in the file URLs; files of approved submissions are
+// served from the revision they became
+func submissionURLs(c *gin.Context, s *Submission) {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s/submissions/%s/file", scheme, c.Request.Host, s.ID)
+	if s.HasSVG {
+		s.LogoURLSVG = baseURL + "?format=svg"
+	}
+	if s.HasPNG {
+		s.LogoURLPNG = baseURL + "?format=png"
+	}
+}
+
+// storedPNGSize reads the dimensions from a stored PNG's header
+func storedPNGSize(ctx context.Context, key string) (int, int) {
+	rc, _, err := store.Get(ctx, key)
+	if err != nil {
+		return 0, 0
+	}
+	defer rc.Close()
+	cfg, err := png.DecodeConfig(rc)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
+
+// compareSubmission builds the side-by-side data for reviewing a submission
+// against the club's current logo
+func compareSubmission(c *gin.Context, s *Submission) *SubmissionComparison {
+	ctx := c.Request.Context()
+	cmp := &SubmissionComparison{
+		Submitted: ComparedLogo{
+			ClubName:    s.ClubName,
+			HasSVG:      s.HasSVG,
+			HasPNG:      s.HasPNG,
+			FileSizeSVG: s.FileSizeSVG,
+			FileSizePNG: s.FileSizePNG,
+			HashSVG:     s.HashSVG,
+			HashPNG:     s.HashPNG,
+			LogoURLSVG:  s.LogoURLSVG,
+			LogoURLPNG:  s.LogoURLPNG,
+		},
+	}
+	if s.HasPNG {
+		cmp.Submitted.WidthPNG, cmp.Submitted.HeightPNG = storedPNGSize(ctx, submissionKey(s, "png"))
+	}
+	// Other clubs whose logo looks the same
+	if s.PHash != "" {
+		if duplicates, err := findSimilarLogos(s.PHash, s.LogoID, duplicateHashDistance, maxDuplicateWarnings); err == nil && len(duplicates) > 0 {
+			cmp.Duplicates = duplicates
+		}
+	}
+
+	revision := currentRevision(s.LogoID)
+	if revision == 0 {
+		return cmp
+	}
+	rev, err := loadLogoRevision(s.LogoID, revision)
+	if err != nil {
+		log.Printf("Warning: Failed to load current revision of %s: %v", s.LogoID, err)
+		return cmp
+	}
+	revisionURLs(c, rev)
+	cmp.Current = &ComparedLogo{
+		Revision:    rev.Revision,
+		ClubName:    rev.ClubName,
+		HasSVG:      rev.HasSVG,
+		HasPNG:      rev.HasPNG,
+		FileSizeSVG: rev.FileSizeSVG,
+		FileSizePNG: rev.FileSizePNG,
+		HashSVG:     rev.HashSVG,
+		HashPNG:     rev.HashPNG,
+		LogoURLSVG:  rev.LogoURLSVG,
+		LogoURLPNG:  rev.LogoURLPNG,
+	}
+	if rev.HasPNG {
+		cmp.Current.WidthPNG, cmp.Current.HeightPNG = storedPNGSize(ctx, revisionKey(rev.LogoID, rev.Revision, "png"))
+	}
+	cmp.SameSVG = s.HasSVG && s.HashSVG == rev.HashSVG
+	cmp.SamePNG = s.HasPNG && s.HashPNG == rev.HashPNG
+
+	changes := map[string][2]string{}
+	for _, field := range []struct{ name, current, submitted string }{
+		{"club_name", rev.ClubName, s.ClubName},
+		{"club_city", rev.ClubCity, s.ClubCity},
+		{"club_type", rev.ClubType, s.ClubType},
+		{"club_website", rev.ClubWebsite, s.ClubWebsite},
+	} {
+		if field.current != field.submitted {
+			changes[field.name] = [2]string{field.current, field.submitted}
+		}
+	}
+	if len(changes) > 0 {
+		cmp.MetadataChanges = changes
+	}
+	return cmp
+}
+
+// approveSubmissionFiles turns a submission into a new revision of its logo
+func approveSubmissionFiles(ctx context.Context, s *Submission, reviewer *APIKey) (int, error) {
+	workDir, err := os.MkdirTemp("", "logo-submission-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(workDir)
+
+	paths := map[string]string{}
+	for _, format := range []string{"svg", "original.svg", "png", "source"} {
+		if (format == "svg" && !s.HasSVG) || (format == "png" && !s.HasPNG) ||
+			(format == "original.svg" && (!s.HasSVG || s.FileSizeSVGOriginal == 0)) ||
+			(format == "source" && s.SourceFormat == "") {
+			continue
+		}
+		key := submissionKey(s, format)
+		if format == "source" {
+			key = submissionKey(s, sourceKeyFormat(s.SourceFormat))
+		}
+		data, _, err := readObject(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("read submitted %s: %w", format, err)
+		}
+		paths[format] = filepath.Join(workDir, s.LogoID+"."+format)
+		if err := os.WriteFile(paths[format], data, 0644); err != nil {
+			return 0, err
+		}
+	}
+
+	rev := &LogoRevision{
+		LogoID:              s.LogoID,
+		ClubName:            s.ClubName,
+		ClubCity:            s.ClubCity,
+		ClubType:            s.ClubType,
+		ClubWebsite:         s.ClubWebsite,
+		HasSVG:              s.HasSVG,
+		HasPNG:              s.HasPNG,
+		FileSizeSVG:         s.FileSizeSVG,
+		FileSizePNG:         s.FileSizePNG,
+		FileSizeSVGOriginal: s.FileSizeSVGOriginal,
+		SourceFormat:        s.SourceFormat,
+		FileSizeSource:      s.FileSizeSource,
+		BackgroundRemoved:   s.BackgroundRemoved,
+		Bounds:              s.Bounds,
+		AspectRatio:         s.AspectRatio,
+		Palette:             s.Palette,
+		PHash:               s.PHash,
+		HashSVG:             s.HashSVG,
+		HashPNG:             s.HashPNG,
+		UploadedBy:          s.SubmitterName,
+		SubmissionID:        s.ID,
+	}
+	if rev.UploadedBy == "" {
+		rev.UploadedBy = "submission"
+	}
+	if reviewer != nil {
+		rev.APIKeyID = reviewer.ID
+	}
+	if err := commitLogoRevision(ctx, rev, paths["svg"], paths["original.svg"], paths["png"], paths["source"]); err != nil {
+		return 0, err
+	}
+	return rev.Revision, nil
+}
+
+// ==================== Submission Handlers ====================
+
+// createSubmission accepts a community upload into the moderation queue.
+// The file is converted in the background. The submission takes the job's
+// ID, so anonymous submitters can follow it without access to the job.
+func createSubmission(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID format"})
+		return
+	}
+
+	form, ok := readLogoUploadForm(c, id)
+	if !ok {
+		return
+	}
+	payload := logoJobPayload{
+		Form:           *form,
+		SubmitterName:  strings.TrimSpace(c.PostForm("submitter_name")),
+		SubmitterEmail: strings.TrimSpace(c.PostForm("submitter_email")),
+		SubmitterIP:    clientIP(c),
+	}
+
+	job, ok := queueLogoJob(c, JobKindLogoSubmission, &payload)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success":        true,
+		"submission_id":  job.ID,
+		"submission_url": requestBaseURL(c) + "/submissions/" + job.ID,
+		"status":         SubmissionProcessing,
+		"message":        "logo submitted, it will be queued for review once processed",
+	})
+}
+
+// runSubmissionJob converts a community upload and stores it as a pending
+// submission
+func runSubmissionJob(ctx context.Context, job *Job, lastAttempt bool) (interface{}, error) {
+	var payload logoJobPayload
+	if err := json.Unmarshal(job.payload, &payload); err != nil {
+		return nil, permanent(err)
+	}
+
+	workDir, err := os.MkdirTemp("", "logo-submission-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	data, _, err := readObject(ctx, payload.InputKey)
+	if err != nil {
+		return nil, fmt.Errorf("read upload: %w", err)
+	}
+	upload, err := processLogoUpload(payload.Form, data, workDir, lastAttempt)
+	if err != nil {
+		return nil, err
+	}
+	rev := upload.Rev
+
+	s := &Submission{
+		ID:                  job.ID,
+		LogoID:              rev.LogoID,
+		Status:              SubmissionPending,
+		ClubName:            rev.ClubName,
+		ClubCity:            rev.ClubCity,
+		ClubType:            rev.ClubType,
+		ClubWebsite:         rev.ClubWebsite,
+		HasSVG:              rev.HasSVG,
+		HasPNG:              rev.HasPNG,
+		FileSizeSVG:         rev.FileSizeSVG,
+		FileSizePNG:         rev.FileSizePNG,
+		FileSizeSVGOriginal: rev.FileSizeSVGOriginal,
+		SourceFormat:        rev.SourceFormat,
+		FileSizeSource:      rev.FileSizeSource,
+		BackgroundRemoved:   rev.BackgroundRemoved,
+		Bounds:              rev.Bounds,
+		AspectRatio:         rev.AspectRatio,
+		Palette:             rev.Palette,
+		PHash:               rev.PHash,
+		HashSVG:             rev.HashSVG,
+		HashPNG:             rev.HashPNG,
+		SubmitterName:       payload.SubmitterName,
+		SubmitterEmail:      payload.SubmitterEmail,
+		SubmitterIP:         payload.SubmitterIP,
+		CreatedAt:           time.Now().UTC(),
+	}
+
+	for _, master := range []struct {
+		format, path, contentType string
+		present                   bool
+	}{
+		{"svg", upload.SVGPath, "image/svg+xml", s.HasSVG},
+		{"original.svg", upload.SVGOriginalPath, "image/svg+xml", s.HasSVG && upload.SVGOriginalPath != ""},
+		{"png", upload.PNGPath, "image/png", s.HasPNG},
+		{sourceKeyFormat(s.SourceFormat), upload.SourcePath, rasterSourceFormats[s.SourceFormat].ContentType, s.SourceFormat != ""},
+	} {
+		if !master.present {
+			continue
+		}
+		if err := putFile(ctx, submissionKey(s, master.format), master.path, master.contentType); err != nil {
+			return nil, fmt.Errorf("store submission: %w", err)
+		}
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO submissions (
+			id, logo_id, status, club_name, club_city, club_type, club_website,
+			has_svg, has_png, file_size_svg, file_size_png, file_size_svg_original, source_format, file_size_source,
+			background_removed, bbox, aspect_ratio, palette, phash, svg_hash, png_hash, submitter_name, submitter_email, submitter_ip, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.ID, s.LogoID, s.Status, s.ClubName, s.ClubCity, s.ClubType, s.ClubWebsite,
+		boolToInt(s.HasSVG), boolToInt(s.HasPNG), s.FileSizeSVG, s.FileSizePNG, nullInt64(s.FileSizeSVGOriginal),
+		nullString(s.SourceFormat), nullInt64(s.FileSizeSource), boolToInt(s.BackgroundRemoved), encodeBounds(s.Bounds), nullFloat64(s.AspectRatio),
+		encodePalette(s.Palette), nullString(s.PHash), nullString(s.HashSVG), nullString(s.HashPNG),
+		nullString(s.SubmitterName), nullString(s.SubmitterEmail), s.SubmitterIP, s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every contributor can read job results, leave out the submitter's
+	// contact details
+	result := gin.H{
+		"submission_id": s.ID,
+		"logo_id":       s.LogoID,
+		"status":        s.Status,
+		"has_svg":       s.HasSVG,
+		"has_png":       s.HasPNG,
+	}
+	if upload.Sanitized != nil {
+		result["sanitized"] = upload.Sanitized
+	}
+	if len(upload.Duplicates) > 0 {
+		result["duplicates"] = upload.Duplicates
+	}
+	if len(upload.Warnings) > 0 {
+		result["warnings"] = upload.Warnings
+	}
+	return result, nil
+}
+
+// loadSubmissionParam loads the submission named by the :sid route parameter,
+// writing an error response when it cannot
+func loadSubmissionParam(c *gin.Context) (*Submission, bool) {
+	sid := c.Param("sid")
+	if _, err := uuid.Parse(sid); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid submission ID"})
+		return nil, false
+	}
+	s, err := loadSubmission(sid)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "submission not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return nil, false
+	}
+	return s, true
+}
+
+// getSubmission returns the public status of a submission, without the
+// submitter's contact details
+func getSubmission(c *gin.Context) {
+	// Until its job has run, the submission is only known by the job
+	if job, err := loadJob(c.Param("sid")); err == nil && job.Kind == JobKindLogoSubmission && job.Status != JobSucceeded {
+		pending := gin.H{
+			"id":         job.ID,
+			"logo_id":    job.LogoID,
+			"status":     SubmissionProcessing,
+			"created_at": job.CreatedAt,
+		}
+		if job.Status == JobFailed {
+			pending["status"], pending["error"] = SubmissionFailed, job.Error
+		}
+		c.JSON(http.StatusOK, pending)
+		return
+	}
+
+	s, ok := loadSubmissionParam(c)
+	if !ok {
+		return
+	}
+	submissionURLs(c, s)
+	s.SubmitterEmail, s.SubmitterIP, s.ReviewerKeyID = "", "", ""
+	c.JSON(http.StatusOK, s)
+}
+
+// getSubmissionFile returns a submitted file (PNG preferred, SVG fallback).
+// Files not approved yet, or rejected, are only served to admins.
+func getSubmissionFile(c *gin.Context) {
+	s, ok := loadSubmissionParam(c)
+	if !ok {
+		return
+	}
+	cacheControl := "public, max-age=31536000, immutable"
+	if s.Status != SubmissionApproved {
+		if !authorizeRole(c, RoleAdmin) {
+			return
+		}
+		cacheControl = "no-store"
+	}
+
+	key := func(format string) string {
+		if s.Status == SubmissionApproved && s.Revision > 0 {
+			return revisionKey(s.LogoID, s.Revision, format)
+		}
+		return submissionKey(s, format)
+	}
+
+	format := c.Query("format")
+	switch {
+	case s.HasPNG && (format == "" || format == "png"):
+		serveStoredObject(c, key("png"), "image/png", cacheControl)
+	case s.HasSVG && (format == "" || format == "svg"):
+		serveStoredObject(c, key("svg"), "image/svg+xml", cacheControl)
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "logo not found"})
+	}
+}
+
+// listSubmissions returns submissions in a state (pending by default, or
+// "all"), oldest first so the queue is worked in order
+func listSubmissions(c *gin.Context) {
+	status := c.DefaultQuery("status", SubmissionPending)
+	query := "SELECT " + submissionColumns + " FROM submissions"
+	var args []interface{}
+	switch status {
+	case "all":
+	case SubmissionPending, SubmissionApproved, SubmissionRejected:
+		query += " WHERE status = ?"
+		args = append(args, status)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+		return
+	}
+	if logoID := c.Query("logo_id"); logoID != "" {
+		if len(args) == 0 {
+			query += " WHERE logo_id = ?"
+		} else {
+			query += " AND logo_id = ?"
+		}
+		args = append(args, logoID)
+	}
+	query += " ORDER BY created_at, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	defer rows.Close()
+
+	submissions := []*Submission{}
+	for rows.Next() {
+		s, err := scanSubmission(rows)
+		if err != nil {
+			continue
+		}
+		submissionURLs(c, s)
+		submissions = append(submissions, s)
+	}
+	c.JSON(http.StatusOK, submissions)
+}
+
+// reviewSubmission returns a submission with comparison data against the
+// club's current logo
+func reviewSubmission(c *gin.Context) {
+	s, ok := loadSubmissionParam(c)
+	if !ok {
+		return
+	}
+	submissionURLs(c, s)
+	s.Comparison = compareSubmission(c, s)
+	c.JSON(http.StatusOK, s)
+}
+
+// reviewNotes reads the optional {"notes": "..."} body of a review action
+func reviewNotes(c *gin.Context) (string, bool) {
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return "", false
+		}
+	}
+	return strings.TrimSpace(req.Notes), true
+}
+
+// decideSubmission moves a pending submission to a final state. It fails
+// when another reviewer decided it first.
+func decideSubmission(s *Submission, status, notes string, reviewer *APIKey) (bool, error) {
+	var reviewedBy, reviewerKeyID string
+	if reviewer != nil {
+		reviewedBy, reviewerKeyID = reviewer.Name, reviewer.ID
+	}
+	res, err := db.Exec(`
+		UPDATE submissions
+		SET status = ?, reviewer_notes = ?, reviewed_by = ?, reviewer_key_id = ?, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, status, nullString(notes), nullString(reviewedBy), nullString(reviewerKeyID), s.ID, SubmissionPending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// submissionConflict reports a submission that was decided by someone else
+func submissionConflict(c *gin.Context, id string) {
+	status := "decided"
+	db.QueryRow("SELECT status FROM submissions WHERE id = ?", id).Scan(&status)
+	c.JSON(http.StatusConflict, gin.H{"error": "submission is already " + status})
+}
+
+// approveSubmission publishes a submission as the club's current logo
+func approveSubmission(c *gin.Context) {
+	s, ok := loadSubmissionParam(c)
+	if !ok {
+		return
+	}
+	notes, ok := reviewNotes(c)
+	if !ok {
+		return
+	}
+
+	reviewer := currentAPIKey(c)
+	decided, err := decideSubmission(s, SubmissionApproved, notes, reviewer)
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !decided {
+		submissionConflict(c, s.ID)
+		return
+	}
+
+	ctx := c.Request.Context()
+	revision, err := approveSubmissionFiles(ctx, s, reviewer)
+	if err != nil {
+		log.Printf("Failed to publish submission %s: %v", s.ID, err)
+		// Put it back in the queue so it can be retried
+		db.Exec(`
+			UPDATE submissions
+			SET status = ?, reviewer_notes = NULL, reviewed_by = NULL, reviewer_key_id = NULL, reviewed_at = NULL, revision = NULL
+			WHERE id = ?
+		`, SubmissionPending, s.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish submission"})
+		return
+	}
+
+	// The files now live in the revision, which commitLogoRevision recorded
+	// on the submission
+	store.Delete(ctx, submissionKey(s, "svg"))
+	store.Delete(ctx, submissionKey(s, "original.svg"))
+	store.Delete(ctx, submissionKey(s, "png"))
+	if s.SourceFormat != "" {
+		store.Delete(ctx, submissionKey(s, sourceKeyFormat(s.SourceFormat)))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"id":       s.ID,
+		"logo_id":  s.LogoID,
+		"status":   SubmissionApproved,
+		"revision": revision,
+		"message":  "submission approved and published",
+	})
+}
+
+// rejectSubmission closes a submission without publishing it; its files are
+// kept for reference
+func rejectSubmission(c *gin.Context) {
+	s, ok := loadSubmissionParam(c)
+	if !ok {
+		return
+	}
+	notes, ok := reviewNotes(c)
+	if !ok {
+		return
+	}
+
+	decided, err := decideSubmission(s, SubmissionRejected, notes, currentAPIKey(c))
+	if err != nil {
+		log.Printf("Database error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		return
+	}
+	if !decided {
+		submissionConflict(c, s.ID)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      s.ID,
+		"logo_id": s.LogoID,
+		"status":  SubmissionRejected,
+		"message": "submission rejected",
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type svgNodeKind int
+
+const (
+	svgElement svgNodeKind = iota
+	svgText
+	svgComment
+	svgProcInst
+	svgDirective
+)
+
+// svgNode is a node of a parsed SVG document. Names keep their original
+// prefixes (e.g. xlink:href has Space "xlink"), so documents serialize back
+// the way they were written.
+type svgNode struct {
+	Kind     svgNodeKind
+	Name     xml.Name
+	Attr     []xml.Attr
+	Text     []byte // text, comment and directive content, or the instruction of a ProcInst
+	Children []*svgNode
+}
+
+// svgDocument is a parsed SVG: nodes before the root element (XML
+// declaration, comments, doctype) followed by the root <svg> element
+type svgDocument struct {
+	Prolog []*svgNode
+	Root   *svgNode
+}
+
+// qualifiedName returns the name as written, with its prefix
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// parseSVGDocument parses an SVG document, rejecting anything that is not
+// well-formed XML with a single <svg> root element. Entities other than the
+// predefined XML ones are rejected rather than expanded.
+func parseSVGDocument(data []byte) (*svgDocument, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	doc := &svgDocument{}
+	var stack []*svgNode
+	appendNode := func(n *svgNode) {
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, n)
+		} else if doc.Root == nil {
+			doc.Prolog = append(doc.Prolog, n)
+		}
+	}
+
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &svgNode{Kind: svgElement, Name: t.Name, Attr: append([]xml.Attr(nil), t.Attr...)}
+			if len(stack) == 0 {
+				if doc.Root != nil {
+					return nil, fmt.Errorf("invalid XML: multiple root elements")
+				}
+				if !strings.EqualFold(t.Name.Local, "svg") {
+					return nil, fmt.Errorf("root element is <%s>, not <svg>", qualifiedName(t.Name))
+				}
+				doc.Root = n
+			} else {
+				appendNode(n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			// RawToken does not match start and end tags itself
+			if len(stack) == 0 || stack[len(stack)-1].Name != t.Name {
+				return nil, fmt.Errorf("invalid XML: unexpected </%s>", qualifiedName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) == 0 {
+				if len(bytes.TrimSpace(t)) > 0 {
+					return nil, fmt.Errorf("invalid XML: text outside the root element")
+				}
+				continue
+			}
+			appendNode(&svgNode{Kind: svgText, Text: append([]byte(nil), t...)})
+		case xml.Comment:
+			if len(stack) == 0 && doc.Root != nil {
+				continue
+			}
+			appendNode(&svgNode{Kind: svgComment, Text: append([]byte(nil), t...)})
+		case xml.ProcInst:
+			if len(stack) == 0 && doc.Root != nil {
+				continue
+			}
+			appendNode(&svgNode{Kind: svgProcInst, Name: xml.Name{Local: t.Target}, Text: append([]byte(nil), t.Inst...)})
+		case xml.Directive:
+			if len(stack) > 0 || doc.Root != nil {
+				return nil, fmt.Errorf("invalid XML: unexpected <!%s>", firstWord(t))
+			}
+			appendNode(&svgNode{Kind: svgDirective, Text: append([]byte(nil), t...)})
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("invalid XML: unclosed <%s>", qualifiedName(stack[len(stack)-1].Name))
+	}
+	if doc.Root == nil {
+		return nil, fmt.Errorf("no <svg> element found")
+	}
+	return doc, nil
+}
+
+func firstWord(b []byte) string {
+	if fields := strings.Fields(string(b)); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// Bytes serializes the document
+func (d *svgDocument) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, n := range d.Prolog {
+		writeSVGNode(&buf, n)
+		if n.Kind != svgText {
+			buf.WriteByte('\n')
+		}
+	}
+	writeSVGNode(&buf, d.Root)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// Only the characters that must be escaped are, unlike xml.EscapeText which
+// also encodes whitespace
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func writeSVGNode(buf *bytes.Buffer, n *svgNode) {
+	switch n.Kind {
+	case svgText:
+		buf.WriteString(textEscaper.Replace(string(n.Text)))
+	case svgComment:
+		buf.WriteString("<!--")
+		buf.Write(n.Text)
+		buf.WriteString("-->")
+	case svgProcInst:
+		buf.WriteString("<?")
+		buf.WriteString(n.Name.Local)
+		if len(n.Text) > 0 {
+			buf.WriteByte(' ')
+			buf.Write(n.Text)
+		}
+		buf.WriteString("?>")
+	case svgDirective:
+		buf.WriteString("<!")
+		buf.Write(n.Text)
+		buf.WriteByte('>')
+	case svgElement:
+		buf.WriteByte('<')
+		buf.WriteString(qualifiedName(n.Name))
+		for _, a := range n.Attr {
+			buf.WriteByte(' ')
+			buf.WriteString(qualifiedName(a.Name))
+			buf.WriteString(`="`)
+			buf.WriteString(attrEscaper.Replace(a.Value))
+			buf.WriteByte('"')
+		}
+		if len(n.Children) == 0 {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteByte('>')
+		for _, child := range n.Children {
+			writeSVGNode(buf, child)
+		}
+		buf.WriteString("</")
+		buf.WriteString(qualifiedName(n.Name))
+		buf.WriteByte('>')
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rounding of coordinates and lengths: a number keeps svgSignificantDigits,
+// or enough decimals to resolve svgViewBoxPrecision of the viewBox size,
+// whichever is finer. Without a viewBox, svgDefaultDecimals is the floor.
+const (
+	svgSignificantDigits = 6
+	svgViewBoxPrecision  = 1e-5
+	svgDefaultDecimals   = 3
+	svgMaxDecimals       = 12
+)
+
+// Namespaces written by editors; their elements and attributes do not
+// affect rendering
+var editorNamespaces = map[string]bool{
+	"http://www.inkscape.org/namespaces/inkscape":            true,
+	"http://sodipodi.sourceforge.net/DTD/sodipodi-0.dtd":     true,
+	"http://ns.adobe.com/AdobeIllustrator/10.0/":             true,
+	"http://ns.adobe.com/AdobeSVGViewerExtensions/3.0/":      true,
+	"http://ns.adobe.com/Extensibility/1.0/":                 true,
+	"http://ns.adobe.com/Flows/1.0/":                         true,
+	"http://ns.adobe.com/Graphs/1.0/":                        true,
+	"http://ns.adobe.com/ImageReplacement/1.0/":              true,
+	"http://ns.adobe.com/SaveForWeb/1.0/":                    true,
+	"http://ns.adobe.com/Variables/1.0/":                     true,
+	"http://ns.adobe.com/xap/1.0/":                           true,
+	"http://www.bohemiancoding.com/sketch/ns":                true,
+	"http://www.serif.com/":                                  true,
+	"http://www.w3.org/1999/02/22-rdf-syntax-ns#":            true,
+	"http://creativecommons.org/ns#":                         true,
+	"http://purl.org/dc/elements/1.1/":                       true,
+	"http://www.figma.com/figma/ns":                          true,
+	"http://www.corel.com/coreldraw/odg":                     true,
+	"http://schemas.microsoft.com/visio/2003/SVGExtensions/": true,
+}
+
+// Prefixes treated as editor namespaces even when they are not declared
+var editorPrefixes = map[string]bool{
+	"inkscape": true,
+	"sodipodi": true,
+	"sketch":   true,
+	"serif":    true,
+	"rdf":      true,
+	"cc":       true,
+	"dc":       true,
+}
+
+// Elements whose text content is rendered, so whitespace inside is kept
+var svgTextElements = map[string]bool{
+	"text":     true,
+	"tspan":    true,
+	"textpath": true,
+	"title":    true,
+	"desc":     true,
+}
+
+// Attributes holding a single length or number
+var svgNumericAttributes = map[string]bool{
+	"x": true, "y": true, "x1": true, "y1": true, "x2": true, "y2": true,
+	"cx": true, "cy": true, "r": true, "rx": true, "ry": true, "fx": true, "fy": true,
+	"width": true, "height": true, "stroke-width": true, "offset": true,
+	"opacity": true, "fill-opacity": true, "stroke-opacity": true, "stop-opacity": true,
+}
+
+var svgNumber = regexp.MustCompile(`[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+var svgWhitespace = regexp.MustCompile(`\s+`)
+
+// OptimizeSVG minifies a (sanitized) SVG: editor metadata and namespaces,
+// comments, the XML declaration and attribute-less or empty groups are
+// removed, coordinates are rounded below what the viewBox can show (see
+// svgSignificantDigits) and insignificant whitespace is dropped. Transform
+// coefficients are kept as written.
+func OptimizeSVG(data []byte) ([]byte, error) {
+	doc, err := parseSVGDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	editors := map[string]bool{}
+	for prefix := range editorPrefixes {
+		editors[prefix] = true
+	}
+	collectEditorPrefixes(doc.Root, editors)
+
+	doc.Prolog = nil
+	optimizeSVGElement(doc.Root, editors, svgMinDecimals(doc.Root))
+	removeUnusedNamespaces(doc.Root)
+
+	return doc.Bytes(), nil
+}
+
+// optimizeSVGFile optimizes an SVG file in place, keeping its previous
+// content at originalPath. The file is left unchanged when optimizing does
+// not make it smaller.
+func optimizeSVGFile(path, originalPath string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(originalPath, data, 0644); err != nil {
+		return err
+	}
+	optimized, err := OptimizeSVG(data)
+	if err != nil {
+		return err
+	}
+	if len(optimized) >= len(data) {
+		return nil
+	}
+	return os.WriteFile(path, optimized, 0644)
+}
+
+// collectEditorPrefixes finds prefixes bound to editor namespace URIs
+func collectEditorPrefixes(n *svgNode, editors map[string]bool) {
+	for _, a := range n.Attr {
+		if a.Name.Space == "xmlns" && editorNamespaces[strings.TrimSpace(a.Value)] {
+			editors[a.Name.Local] = true
+		}
+	}
+	for _, child := range n.Children {
+		if child.Kind == svgElement {
+			collectEditorPrefixes(child, editors)
+		}
+	}
+}
+
+// svgMinDecimals returns the decimals that resolve svgViewBoxPrecision of
+// the root's viewBox (or width and height)
+func svgMinDecimals(root *svgNode) int {
+	size := 0.0
+	if vb := strings.Fields(strings.ReplaceAll(svgAttr(root, "viewBox"), ",", " ")); len(vb) == 4 {
+		w, _ := strconv.ParseFloat(vb[2], 64)
+		h, _ := strconv.ParseFloat(vb[3], 64)
+		size = math.Max(w, h)
+	} else {
+		w, _ := strconv.ParseFloat(strings.TrimSuffix(svgAttr(root, "width"), "px"), 64)
+		h, _ := strconv.ParseFloat(strings.TrimSuffix(svgAttr(root, "height"), "px"), 64)
+		size = math.Max(w, h)
+	}
+	if size <= 0 || math.IsInf(size, 0) || math.IsNaN(size) {
+		return svgDefaultDecimals
+	}
+	return min(svgMaxDecimals, max(0, int(math.Ceil(-math.Log10(size*svgViewBoxPrecision)))))
+}
+
+// svgAttr returns an attribute of n without namespace
+func svgAttr(n *svgNode, name string) string {
+	for _, a := range n.Attr {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
+}
+
+func optimizeSVGElement(n *svgNode, editors map[string]bool, decimals int) {
+	local := strings.ToLower(n.Name.Local)
+
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if editors[a.Name.Space] || (a.Name.Space == "xmlns" && editors[a.Name.Local]) {
+			continue
+		}
+		if a.Name.Space == "" {
+			a.Value = optimizeSVGAttribute(strings.ToLower(a.Name.Local), a.Value, decimals)
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+
+	var children []*svgNode
+	for _, child := range n.Children {
+		switch child.Kind {
+		case svgComment, svgProcInst, svgDirective:
+			continue
+		case svgText:
+			if svgTextElements[local] {
+				break
+			}
+			if len(bytes.TrimSpace(child.Text)) == 0 {
+				continue
+			}
+			if local == "style" {
+				child.Text = []byte(strings.TrimSpace(svgWhitespace.ReplaceAllString(string(child.Text), " ")))
+			}
+		case svgElement:
+			childName := strings.ToLower(child.Name.Local)
+			if editors[child.Name.Space] || (child.Name.Space == "" && childName == "metadata") {
+				continue
+			}
+			optimizeSVGElement(child, editors, decimals)
+			// Groups without attributes only add nesting
+			if child.Name.Space == "" && childName == "g" && len(child.Attr) == 0 {
+				children = append(children, child.Children...)
+				continue
+			}
+			if child.Name.Space == "" && (childName == "g" || childName == "defs") && len(child.Children) == 0 {
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	n.Children = children
+}
+
+// optimizeSVGAttribute rounds the numbers of geometry attributes to at
+// least decimals places (see formatSVGNumber). Transforms only lose
+// whitespace: a rounded scale factor distorts everything it applies to.
+func optimizeSVGAttribute(name, value string, decimals int) string {
+	switch {
+	case name == "d":
+		if d, ok := optimizePathData(value, decimals); ok {
+			return d
+		}
+	case name == "points":
+		value = svgNumber.ReplaceAllStringFunc(value, func(s string) string {
+			if v, err := strconv.ParseFloat(s, 64); err == nil {
+				return formatSVGNumber(v, decimals)
+			}
+			return s
+		})
+		return strings.TrimSpace(svgWhitespace.ReplaceAllString(value, " "))
+	case name == "transform" || name == "gradienttransform" || name == "patterntransform":
+		return strings.TrimSpace(svgWhitespace.ReplaceAllString(value, " "))
+	case svgNumericAttributes[name]:
+		trimmed := strings.TrimSpace(value)
+		unit := strings.TrimLeft(trimmed, "+-.0123456789eE")
+		if unit != "" && unit != "px" && unit != "%" {
+			return value
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSuffix(trimmed, unit), 64); err == nil {
+			if unit == "px" {
+				unit = ""
+			}
+			return formatSVGNumber(v, decimals) + unit
+		}
+	}
+	return value
+}
+
+// Number of arguments taken by each path command
+var pathCommandArgs = map[byte]int{
+	'M': 2, 'L': 2, 'H': 1, 'V': 1, 'C': 6, 'S': 4, 'Q': 4, 'T': 2, 'A': 7, 'Z': 0,
+}
+
+// optimizePathData rewrites path data with rounded numbers and minimal
+// separators. Malformed data is reported with ok == false and left alone.
+func optimizePathData(d string, decimals int) (string, bool) {
+	var b strings.Builder
+	var cmd byte
+	argIndex := 0
+	prev := "" // last number written, to decide whether a separator is needed
+
+	i := 0
+	for i < len(d) {
+		c := d[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			continue
+		case pathCommandArgs[upperASCII(c)] > 0 || upperASCII(c) == 'Z':
+			cmd = c
+			argIndex = 0
+			b.WriteByte(c)
+			prev = ""
+			i++
+			continue
+		}
+		if cmd == 0 {
+			return d, false
+		}
+
+		n := pathCommandArgs[upperASCII(cmd)]
+		if n == 0 {
+			return d, false
+		}
+		var num string
+		if upperASCII(cmd) == 'A' && (argIndex%7 == 3 || argIndex%7 == 4) {
+			// Arc flags are single digits and may be written without separators
+			if c != '0' && c != '1' {
+				return d, false
+			}
+			num = string(c)
+			i++
+		} else {
+			loc := svgNumber.FindStringIndex(d[i:])
+			if loc == nil || loc[0] != 0 {
+				return d, false
+			}
+			v, err := strconv.ParseFloat(d[i:i+loc[1]], 64)
+			if err != nil {
+				return d, false
+			}
+			num = formatSVGNumber(v, decimals)
+			i += loc[1]
+		}
+
+		if prev != "" && !strings.HasPrefix(num, "-") &&
+			!(strings.HasPrefix(num, ".") && strings.Contains(prev, ".")) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(num)
+		prev = num
+		argIndex++
+	}
+	return b.String(), true
+}
+
+func upperASCII(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// formatSVGNumber rounds v to svgSignificantDigits, but to no fewer than
+// minDecimals decimals, and writes it in its shortest form (".5" rather
+// than "0.5")
+func formatSVGNumber(v float64, minDecimals int) string {
+	if v == 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return "0"
+	}
+	decimals := svgSignificantDigits - 1 - int(math.Floor(math.Log10(math.Abs(v))))
+	decimals = min(svgMaxDecimals, max(0, minDecimals, decimals))
+	v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'f', decimals, 64), 64)
+	if v == 0 {
+		return "0"
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if strings.HasPrefix(s, "0.") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "-0.") {
+		s = "-" + s[2:]
+	}
+	return s
+}
+
+// removeUnusedNamespaces drops xmlns:prefix declarations from the root that
+// no element or attribute uses anymore
+func removeUnusedNamespaces(root *svgNode) {
+	used := map[string]bool{}
+	var walk func(n *svgNode)
+	walk = func(n *svgNode) {
+		used[n.Name.Space] = true
+		for _, a := range n.Attr {
+			if a.Name.Space != "xmlns" {
+				used[a.Name.Space] = true
+			}
+		}
+		for _, child := range n.Children {
+			if child.Kind == svgElement {
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	attrs := root.Attr[:0]
+	for _, a := range root.Attr {
+		if a.Name.Space == "xmlns" && !used[a.Name.Local] {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	root.Attr = attrs
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Elements that can run script or embed foreign content
+var unsafeSVGElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// Animation elements can rewrite attributes after sanitization
+var svgAnimationElements = map[string]bool{
+	"animate":          true,
+	"animatemotion":    true,
+	"animatetransform": true,
+	"set":              true,
+}
+
+// Only local fragments and inline raster images may be referenced
+var safeSVGReference = regexp.MustCompile(`^(#|data:image/(png|jpeg|gif|webp);)`)
+
+var cssImportRule = regexp.MustCompile(`(?i)@import[^;]*;?`)
+
+// SVGSanitizeReport lists what the sanitizer removed from a document
+type SVGSanitizeReport struct {
+	Removed []string `json:"removed"`
+}
+
+func (r *SVGSanitizeReport) add(format string, args ...interface{}) {
+	r.Removed = append(r.Removed, fmt.Sprintf(format, args...))
+}
+
+// SanitizeSVG parses an SVG and strips everything that could execute script
+// or load remote resources when the file is opened directly in a browser:
+// script-capable elements, event handler attributes, javascript: and remote
+// links, external url() references, stylesheet imports and doctypes.
+// Documents that cannot be parsed are rejected.
+func SanitizeSVG(data []byte) ([]byte, *SVGSanitizeReport, error) {
+	doc, err := parseSVGDocument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &SVGSanitizeReport{Removed: []string{}}
+	var prolog []*svgNode
+	for _, n := range doc.Prolog {
+		switch {
+		case n.Kind == svgDirective:
+			report.add("removed <!%s> declaration", firstWord(n.Text))
+		case n.Kind == svgProcInst && n.Name.Local != "xml":
+			report.add("removed <?%s?> processing instruction", n.Name.Local)
+		default:
+			prolog = append(prolog, n)
+		}
+	}
+	doc.Prolog = prolog
+	sanitizeSVGElement(doc.Root, report)
+
+	return doc.Bytes(), report, nil
+}
+
+// sanitizeSVGFile sanitizes an SVG file in place
+func sanitizeSVGFile(path string) (*SVGSanitizeReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	clean, report, err := SanitizeSVG(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, clean, 0644); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func sanitizeSVGElement(n *svgNode, report *SVGSanitizeReport) {
+	name := qualifiedName(n.Name)
+
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		attrName := qualifiedName(a.Name)
+		local := strings.ToLower(a.Name.Local)
+		value := strings.TrimSpace(a.Value)
+		switch {
+		case strings.HasPrefix(local, "on"):
+			report.add("removed %s attribute from <%s>", attrName, name)
+			continue
+		case local == "href" || local == "src":
+			if !safeSVGReference.MatchString(strings.ToLower(value)) {
+				report.add("removed %s=%q from <%s>", attrName, truncateForReport(value), name)
+				continue
+			}
+		}
+		if strings.Contains(strings.ToLower(a.Value), "url(") || local == "style" {
+			if clean, changed := sanitizeCSS(a.Value); changed {
+				report.add("removed external references from %s of <%s>", attrName, name)
+				a.Value = clean
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+
+	children := n.Children[:0]
+	for _, child := range n.Children {
+		switch child.Kind {
+		case svgElement:
+			childName := strings.ToLower(child.Name.Local)
+			if unsafeSVGElements[childName] {
+				report.add("removed <%s> element", qualifiedName(child.Name))
+				continue
+			}
+			if svgAnimationElements[childName] && animatesUnsafeAttribute(child) {
+				report.add("removed <%s> element animating a link or event attribute", qualifiedName(child.Name))
+				continue
+			}
+			sanitizeSVGElement(child, report)
+			if childName == "style" {
+				sanitizeStyleElement(child, report)
+			}
+		case svgProcInst, svgDirective:
+			report.add("removed nested markup declaration from <%s>", name)
+			continue
+		}
+		children = append(children, child)
+	}
+	n.Children = children
+}
+
+// animatesUnsafeAttribute reports whether an animation element targets an
+// attribute the sanitizer restricts
+func animatesUnsafeAttribute(n *svgNode) bool {
+	for _, a := range n.Attr {
+		if strings.ToLower(a.Name.Local) != "attributename" {
+			continue
+		}
+		target := strings.ToLower(strings.TrimSpace(a.Value))
+		if i := strings.IndexByte(target, ':'); i >= 0 {
+			target = target[i+1:]
+		}
+		return target == "href" || target == "src" || strings.HasPrefix(target, "on")
+	}
+	return false
+}
+
+func sanitizeStyleElement(n *svgNode, report *SVGSanitizeReport) {
+	for _, child := range n.Children {
+		if child.Kind != svgText {
+			continue
+		}
+		if clean, changed := sanitizeCSS(string(child.Text)); changed {
+			report.add("removed external references from <%s> stylesheet", qualifiedName(n.Name))
+			child.Text = []byte(clean)
+		}
+	}
+}
+
+// sanitizeCSS drops @import rules and replaces url() references that are not
+// local fragments or inline raster images with none
+func sanitizeCSS(css string) (string, bool) {
+	changed := false
+	if cssImportRule.MatchString(css) {
+		css = cssImportRule.ReplaceAllString(css, "")
+		changed = true
+	}
+
+	var b strings.Builder
+	rest := css
+	for {
+		i := indexFold(rest, "url(")
+		if i < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[i:], ')')
+		if end < 0 {
+			// Unterminated url( swallows the rest of the declaration
+			b.WriteString(rest[:i])
+			b.WriteString("none")
+			changed = true
+			break
+		}
+		ref := strings.Trim(strings.TrimSpace(rest[i+4:i+end]), `"'`)
+		b.WriteString(rest[:i])
+		if safeSVGReference.MatchString(strings.ToLower(strings.TrimSpace(ref))) {
+			b.WriteString(rest[i : i+end+1])
+		} else {
+			b.WriteString("none")
+			changed = true
+		}
+		rest = rest[i+end+1:]
+	}
+	return b.String(), changed
+}
+
+// indexFold is a case-insensitive strings.Index for ASCII needles
+func indexFold(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func truncateForReport(s string) string {
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Upstream request defaults. Failed requests are retried with exponential
+// backoff and full jitter between upstreamBaseBackoff and upstreamMaxBackoff.
+const (
+	defaultUpstreamRateLimit        = 2.0
+	defaultUpstreamMaxAttempts      = 3
+	defaultUpstreamBreakerThreshold = 5
+	defaultUpstreamBreakerCooldown  = 30 * time.Second
+	upstreamRequestTimeout          = 12 * time.Second
+	upstreamBaseBackoff             = 250 * time.Millisecond
+	upstreamMaxBackoff              = 4 * time.Second
+)
+
+// ErrCircuitOpen is returned without contacting an upstream host whose
+// circuit breaker is open
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// UpstreamStatus is the circuit breaker state of one host, reported by /health
+type UpstreamStatus struct {
+	State         string     `json:"state"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastFailureAt *time.Time `json:"last_failure_at,omitempty"`
+	RetryAt       *time.Time `json:"retry_at,omitempty"`
+}
+
+// circuitBreaker opens after threshold failed requests in a row. Once the
+// cooldown has passed a single probe request is let through; it closes the
+// breaker again or keeps it open for another cooldown.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	cooldown    time.Duration
+	state       string
+	failures    int
+	probing     bool
+	lastError   string
+	lastFailure time.Time
+	openedAt    time.Time
+}
+
+// allow tells whether a request may be sent now
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.probing = breakerClosed, 0, false
+}
+
+// failure records a failed request, opening the breaker at the threshold
+// or when the half-open probe failed
+func (b *circuitBreaker) failure(err error) (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.lastError = err.Error()
+	b.lastFailure = time.Now().UTC()
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state, b.probing, b.openedAt = breakerOpen, false, b.lastFailure
+		return true
+	}
+	return false
+}
+
+// release gives up a half-open probe that ended without an answer
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) status() UpstreamStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := UpstreamStatus{State: b.state, Failures: b.failures, LastError: b.lastError}
+	if !b.lastFailure.IsZero() {
+		t := b.lastFailure
+		status.LastFailureAt = &t
+	}
+	if b.state == breakerOpen {
+		t := b.openedAt.Add(b.cooldown)
+		if time.Now().Before(t) {
+			status.RetryAt = &t
+		} else {
+			// The next request is the probe
+			status.State = breakerHalfOpen
+		}
+	}
+	return status
+}
+
+// upstreamHost is the rate limiter and circuit breaker of one host
+type upstreamHost struct {
+	limiter *rate.Limiter
+	breaker *circuitBreaker
+}
+
+// UpstreamClient sends the requests of the club sources. Each host gets its
+// own rate limiter and circuit breaker; failed requests are retried.
+type UpstreamClient struct {
+	httpClient  *http.Client
+	rateLimit   rate.Limit
+	maxAttempts int
+	threshold   int
+	cooldown    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*upstreamHost
+}
+
+// upstream serves the club sources' requests; see newUpstreamClientFromEnv
+var upstream *UpstreamClient
+
+// envPositive reads a positive number from the environment
+func envPositive(name string, fallback float64) (float64, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive number", name, v)
+	}
+	return f, nil
+}
+
+// newUpstreamClientFromEnv configures the upstream client with
+// UPSTREAM_RATE_LIMIT (requests per second and host), UPSTREAM_MAX_ATTEMPTS,
+// UPSTREAM_BREAKER_THRESHOLD and UPSTREAM_BREAKER_COOLDOWN
+func newUpstreamClientFromEnv() (*UpstreamClient, error) {
+	rateLimit, err := envPositive("UPSTREAM_RATE_LIMIT", defaultUpstreamRateLimit)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := envPositive("UPSTREAM_MAX_ATTEMPTS", defaultUpstreamMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := envPositive("UPSTREAM_BREAKER_THRESHOLD", defaultUpstreamBreakerThreshold)
+	if err != nil {
+		return nil, err
+	}
+	cooldown, err := envDuration("UPSTREAM_BREAKER_COOLDOWN", defaultUpstreamBreakerCooldown)
+	if err != nil {
+		return nil, err
+	}
+	return &UpstreamClient{
+		httpClient:  &http.Client{Timeout: upstreamRequestTimeout},
+		rateLimit:   rate.Limit(rateLimit),
+		maxAttempts: int(attempts),
+		threshold:   int(threshold),
+		cooldown:    cooldown,
+		hosts:       make(map[string]*upstreamHost),
+	}, nil
+}
+
+// host returns the state of the host of rawURL, creating it on first use
+func (u *UpstreamClient) host(rawURL string) (string, *upstreamHost) {
+	name := rawURL
+	if parsed, err := neturl.Parse(rawURL); err == nil && parsed.Host != "" {
+		name = parsed.Host
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	h, ok := u.hosts[name]
+	if !ok {
+		h = &upstreamHost{
+			limiter: rate.NewLimiter(u.rateLimit, max(1, int(u.rateLimit))),
+			breaker: &circuitBreaker{threshold: u.threshold, cooldown: u.cooldown, state: breakerClosed},
+		}
+		u.hosts[name] = h
+	}
+	return name, h
+}
+
+// Register lists a base URL's host in Status before its first request
+func (u *UpstreamClient) Register(baseURL string) {
+	u.host(baseURL)
+}
+
+// Status reports the circuit breaker of every host
+func (u *UpstreamClient) Status() map[string]UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	status := make(map[string]UpstreamStatus, len(u.hosts))
+	for name, h := range u.hosts {
+		status[name] = h.breaker.status()
+	}
+	return status
+}
+
+// retryable tells whether a response is worth asking again for
+func retryable(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff is the wait before retry attempt n (1 for the first retry). A
+// Retry-After longer than upstreamMaxBackoff is not waited for.
+func backoff(n int, resp *http.Response) (time.Duration, bool) {
+	wait := upstreamBaseBackoff << (n - 1)
+	if wait <= 0 || wait > upstreamMaxBackoff {
+		wait = upstreamMaxBackoff
+	}
+	wait = time.Duration(rand.Int63n(int64(wait)) + 1)
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			after := time.Duration(secs) * time.Second
+			if after > upstreamMaxBackoff {
+				return 0, false
+			}
+			wait = max(wait, after)
+		}
+	}
+	return wait, true
+}
+
+// Do sends a GET request without a body, waiting for the host's rate limit
+// and retrying network errors, 429 and 5xx responses. The last response is
+// returned when every attempt failed. Requests to a host whose breaker is
+// open fail with ErrCircuitOpen.
+func (u *UpstreamClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	name, h := u.host(req.URL.String())
+	if !h.breaker.allow() {
+		return nil, fmt.Errorf("%s: %w", name, ErrCircuitOpen)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err := h.limiter.Wait(ctx); err != nil {
+			h.breaker.release()
+			return nil, err
+		}
+		resp, err = u.httpClient.Do(req.Clone(ctx))
+		if err == nil && !retryable(resp) {
+			break
+		}
+		if attempt >= u.maxAttempts || ctx.Err() != nil {
+			break
+		}
+		wait, ok := backoff(attempt, resp)
+		if !ok {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			h.breaker.release()
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up, which says nothing about the host
+		h.breaker.release()
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, ctx.Err()
+	case err != nil:
+		u.recordFailure(name, h, err)
+	case retryable(resp):
+		u.recordFailure(name, h, fmt.Errorf("status %d", resp.StatusCode))
+	default:
+		h.breaker.success()
+	}
+	return resp, err
+}
+
+func (u *UpstreamClient) recordFailure(name string, h *upstreamHost, err error) {
+	if h.breaker.failure(err) {
+		log.Printf("⚠️  Upstream %s is failing (%v), pausing requests for %s", name, err, u.cooldown)
+	}
+}
+
+// Get sends a GET request with the given headers through Do
+func (u *UpstreamClient) Get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		req.Header = header
+	}
+	return u.Do(ctx, req)
+}
+
+// ==================== Health Handlers ====================
+
+// healthCheck reports the service as degraded while an upstream circuit
+// breaker is open; club search keeps working from the directory and cache
+func healthCheck(c *gin.Context) {
+	status := "ok"
+	upstreams := map[string]UpstreamStatus{}
+	if upstream != nil {
+		upstreams = upstream.Status()
+	}
+	for _, s := range upstreams {
+		if s.State != breakerClosed {
+			status = "degraded"
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "upstreams": upstreams})
+}
@@ -1,6 +1,7 @@
 import React, { useEffect, useRef, useState } from 'react'
 import gsap from 'gsap'
 import { TopNav, SiteFooter } from './layout'
+import { authHeaders, clearApiKey } from './apiKey'
 
 const API_BASE_URL = '/api'
 const FACR_API_URL = 'https://facr.tdvorak.dev'
@@ -122,14 +123,17 @@ const AdminApp: React.FC = () => {
 
       let existingLogos: ExistingLogo[] = []
       try {
-        const logosResponse = await fetch(`${API_BASE_URL}/logos`)
-        if (logosResponse.ok) {
+        let cursor = ''
+        do {
+          const logosUrl = `${API_BASE_URL}/logos?limit=500${cursor ? `&cursor=${encodeURIComponent(cursor)}` : ''}`
+          const logosResponse = await fetch(logosUrl)
+          if (!logosResponse.ok) break
           const logosContentType = logosResponse.headers.get('content-type') || ''
-          if (logosContentType.includes('application/json')) {
-            const logosData = (await logosResponse.json()) as ExistingLogo[]
-            existingLogos = logosData || []
-          }
-        }
+          if (!logosContentType.includes('application/json')) break
+          const logosData = (await logosResponse.json()) as { items: ExistingLogo[]; next_cursor?: string }
+          existingLogos = existingLogos.concat(logosData.items || [])
+          cursor = logosData.next_cursor || ''
+        } while (cursor)
       } catch {
         // optional
       }
@@ -198,12 +202,12 @@ const AdminApp: React.FC = () => {
     const validFiles: SelectedFile[] = []
     for (const file of files) {
       const ext = file.name.split('.').pop()?.toLowerCase() || ''
-      if (ext === 'svg' || ext === 'png' || ext === 'pdf') {
+      if (['svg', 'png', 'pdf', 'jpg', 'jpeg', 'webp', 'gif'].includes(ext)) {
         validFiles.push({ file, ext, name: '', description: '' })
       }
     }
     if (validFiles.length === 0) {
-      showNotification('Vyberte prosím SVG, PNG nebo PDF soubory', 'error')
+      showNotification('Vyberte prosím SVG, PNG, PDF, JPEG, WebP nebo GIF soubory', 'error')
       return
     }
     setSelectedFiles(validFiles)
@@ -253,9 +257,12 @@ const AdminApp: React.FC = () => {
       if (contentType.includes('svg')) ext = 'svg'
       else if (contentType.includes('pdf')) ext = 'pdf'
       else if (contentType.includes('png')) ext = 'png'
+      else if (contentType.includes('jpeg')) ext = 'jpg'
+      else if (contentType.includes('webp')) ext = 'webp'
+      else if (contentType.includes('gif')) ext = 'gif'
       else {
         const urlExt = url.split('.').pop()?.toLowerCase().split('?')[0]
-        if (urlExt && ['svg', 'png', 'pdf'].includes(urlExt)) ext = urlExt
+        if (urlExt && ['svg', 'png', 'pdf', 'jpg', 'jpeg', 'webp', 'gif'].includes(urlExt)) ext = urlExt
       }
 
       const filename = `logo-${Date.now()}.${ext}`
@@ -284,6 +291,17 @@ const AdminApp: React.FC = () => {
     if (fileInputRef.current) fileInputRef.current.value = ''
   }
 
+  const waitForJob = async (jobId: string) => {
+    for (;;) {
+      const response = await fetch(`${API_BASE_URL}/jobs/${jobId}`, { headers: authHeaders() })
+      if (!response.ok) throw new Error('Stav zpracování nelze zjistit')
+      const job = await response.json()
+      if (job.status === 'succeeded') return job.result
+      if (job.status === 'failed') throw new Error(job.error || 'Zpracování selhalo')
+      await new Promise((resolve) => window.setTimeout(resolve, 1000))
+    }
+  }
+
   const uploadLogos = async (
     uuid: string,
     clubNameValue: string,
@@ -314,10 +332,13 @@ const AdminApp: React.FC = () => {
 
         const response = await fetch(`${API_BASE_URL}/logos/${uuid}`, {
           method: 'POST',
+          headers: authHeaders(),
           body: formData,
         })
 
         if (!response.ok) {
+          // Forget a rejected key so the next attempt asks again
+          if (response.status === 401 || response.status === 403) clearApiKey()
           let message = 'Upload failed'
           try {
             const errorData = await response.json()
@@ -328,6 +349,10 @@ const AdminApp: React.FC = () => {
           throw new Error(message)
         }
 
+        // Conversion runs in the background; wait for the job to finish
+        const { job } = await response.json()
+        if (job?.id) await waitForJob(job.id)
+
         uploadedCount++
         setUploadProgress({ uploaded: uploadedCount, total: filesData.length })
       }
@@ -810,12 +835,12 @@ const AdminApp: React.FC = () => {
                     SVG, PNG nebo PDF • Preferováno průhledné pozadí
                   </p>
                   <p className="text-xs text-gray-600 mt-2">
-                    SVG a PDF soubory budou automaticky převedeny na PNG
+                    SVG, PDF, JPEG, WebP a GIF soubory budou automaticky převedeny na PNG
                   </p>
                   <input
                     type="file"
                     id="fileInput"
-                    accept=".svg,.png,.pdf"
+                    accept=".svg,.png,.pdf,.jpg,.jpeg,.webp,.gif"
                     className="hidden"
                     multiple
                     ref={fileInputRef}
@@ -845,7 +870,7 @@ const AdminApp: React.FC = () => {
                     const sizeKB = (fileObj.file.size / 1024).toFixed(2)
                     const isPrimary = index === 0
                     const icon =
-                      fileObj.ext === 'svg' ? 'SVG' : fileObj.ext === 'pdf' ? 'PDF' : 'PNG'
+                      fileObj.ext === 'jpeg' ? 'JPG' : fileObj.ext.toUpperCase()
                     return (
                       <div
                         key={index}
@@ -55,9 +55,9 @@ function useRecentLogos() {
       try {
         const resp = await fetch(`${API_BASE_URL}/logos?sort=recent&limit=8`)
         if (!resp.ok) throw new Error('Failed to fetch recent logos')
-        const data: Logo[] = await resp.json()
-        setLogos(data)
-        setFiltered(data)
+        const data: { items: Logo[] } = await resp.json()
+        setLogos(data.items)
+        setFiltered(data.items)
       } catch (e) {
         console.error(e)
         setError('Načtení log selhalo')
@@ -48,6 +48,7 @@ const DocsApp: React.FC = () => {
             <pre className="bg-dark-bg rounded-lg p-4 overflow-x-auto">
               <code className="text-sm">
                 {`curl -X POST https://logoapi.sportcreative.eu/logos/{club-uuid} \
+  -H "X-API-Key: YOUR_API_KEY" \
   -F "file=@logo.svg" \
   -F "club_name=Název Klubu"`}
               </code>
@@ -102,17 +103,22 @@ curl https://loga.sportcreative.eu/api/logos/{uuid}`}
                 Response 200:
               </h4>
               <pre className="text-sm overflow-x-auto">
-                <code>{`[
-  {
-    "id": "uuid-here",
-    "club_name": "AC Sparta Praha",
-    "club_type": "football",
-    "has_svg": true,
-    "has_png": true,
-    "logo_url": "https://logoapi.sportcreative.eu/logos/uuid-here",
-    "created_at": "2024-01-01T12:00:00Z"
-  }
-]`}</code>
+                <code>{`{
+  "items": [
+    {
+      "id": "uuid-here",
+      "club_name": "AC Sparta Praha",
+      "club_type": "football",
+      "has_svg": true,
+      "has_png": true,
+      "logo_url": "https://logoapi.sportcreative.eu/logos/uuid-here",
+      "created_at": "2024-01-01T12:00:00Z"
+    }
+  ],
+  "total": 1,
+  "limit": 50,
+  "next_cursor": "eyJzIjoibmFtZSIs..."
+}`}</code>
               </pre>
             </div>
           </div>
@@ -290,7 +296,7 @@ curl https://loga.sportcreative.eu/api/logos/{uuid}`}
               <p className="text-xs text-gray-400 mt-2">
                 Možné chyby: <code>"no file provided"</code>,{' '}
                 <code>"invalid UUID format"</code>,{' '}
-                <code>"only .svg, .png and .pdf files are allowed"</code>
+                <code>"unsupported file type, expected SVG, PNG, PDF, JPEG, WebP or GIF"</code>
               </p>
             </div>
           </div>
@@ -315,6 +321,7 @@ curl https://loga.sportcreative.eu/api/logos/{uuid}`}
                 <pre className="bg-dark-bg rounded-lg p-4 overflow-x-auto">
                   <code className="text-sm">
                     {`curl -X POST https://logoapi.sportcreative.eu/logos/550e8400-e29b-41d4-a716-446655440000 \
+  -H "X-API-Key: YOUR_API_KEY" \
   -F "file=@sparta_logo.svg" \
   -F "club_name=AC Sparta Praha"`}
                   </code>
@@ -327,6 +334,7 @@ curl https://loga.sportcreative.eu/api/logos/{uuid}`}
                 <pre className="bg-dark-bg rounded-lg p-4 overflow-x-auto">
                   <code className="text-sm">
                     {`curl -X POST https://logoapi.sportcreative.eu/logos/550e8400-e29b-41d4-a716-446655440000 \
+  -H "X-API-Key: YOUR_API_KEY" \
   -F "file=@sparta_logo.svg" \
   -F "club_name=AC Sparta Praha" \
   -F "club_type=football" \
@@ -342,6 +350,7 @@ curl https://loga.sportcreative.eu/api/logos/{uuid}`}
                 <pre className="bg-dark-bg rounded-lg p-4 overflow-x-auto">
                   <code className="text-sm">
                     {`curl -X POST https://logoapi.sportcreative.eu/logos/550e8400-e29b-41d4-a716-446655440000 \
+  -H "X-API-Key: YOUR_API_KEY" \
   -F "file=@sparta_logo.png" \
   -F "club_name=AC Sparta Praha"`}
                   </code>
@@ -374,6 +383,7 @@ async function uploadClubLogo(clubId, file, clubData) {
     'https://logoapi.sportcreative.eu/logos/' + clubId,
     {
       method: 'POST',
+      headers: { 'X-API-Key': API_KEY }, // klíč s rolí contributor
       body: formData,
     }
   );
@@ -383,7 +393,16 @@ async function uploadClubLogo(clubId, file, clubData) {
     throw new Error(error.error);
   }
   
-  return await response.json();
+  // Konverze běží na pozadí (202), počkejte na dokončení úlohy
+  const { job } = await response.json();
+  for (;;) {
+    const status = await fetch('https://logoapi.sportcreative.eu/jobs/' + job.id, {
+      headers: { 'X-API-Key': API_KEY },
+    }).then((r) => r.json());
+    if (status.status === 'succeeded') return status.result;
+    if (status.status === 'failed') throw new Error(status.error);
+    await new Promise((resolve) => setTimeout(resolve, 1000));
+  }
 }
 
 // Použití s file input
@@ -1,5 +1,6 @@
 import React, { useCallback, useEffect, useState } from 'react'
 import { TopNav, SiteFooter } from './layout'
+import { authHeaders, clearApiKey } from './apiKey'
 
 const API_BASE_URL = '/api'
 const PAGE_SIZE = 20
@@ -15,7 +16,7 @@ type Logo = {
 
 const LogosApp: React.FC = () => {
   const [logos, setLogos] = useState<Logo[]>([])
-  const [page, setPage] = useState(1)
+  const [cursor, setCursor] = useState<string | null>(null)
   const [hasMore, setHasMore] = useState(true)
   const [loading, setLoading] = useState(false)
   const [error, setError] = useState<string | null>(null)
@@ -30,7 +31,7 @@ const LogosApp: React.FC = () => {
     setQuery('')
     setTypeFilter('all')
     setSort('recent')
-    setPage(1)
+    setCursor(null)
   }
 
   useEffect(() => {
@@ -45,30 +46,25 @@ const LogosApp: React.FC = () => {
       setError(null)
 
       try {
-        const nextPage = reset ? 1 : page
         const url = new URL(`${API_BASE_URL}/logos`, window.location.origin)
         url.searchParams.set('sort', sort)
         url.searchParams.set('limit', String(PAGE_SIZE))
-        url.searchParams.set('page', String(nextPage))
+        if (!reset && cursor) url.searchParams.set('cursor', cursor)
         if (debouncedQuery) url.searchParams.set('q', debouncedQuery)
         if (typeFilter !== 'all') url.searchParams.set('type', typeFilter)
 
         const resp = await fetch(url.toString().replace(window.location.origin, ''))
         if (!resp.ok) throw new Error('Failed to fetch logos')
-        const data: Logo[] = await resp.json()
+        const data: { items: Logo[]; next_cursor?: string } = await resp.json()
 
         if (reset) {
-          setLogos(data)
+          setLogos(data.items)
         } else {
-          setLogos((prev) => [...prev, ...data])
+          setLogos((prev) => [...prev, ...data.items])
         }
 
-        if (Array.isArray(data) && data.length === PAGE_SIZE) {
-          setHasMore(true)
-          setPage(nextPage + 1)
-        } else {
-          setHasMore(false)
-        }
+        setCursor(data.next_cursor || null)
+        setHasMore(Boolean(data.next_cursor))
       } catch (e) {
         if (reset) {
           setError('Načtení log selhalo')
@@ -79,7 +75,7 @@ const LogosApp: React.FC = () => {
         setLoading(false)
       }
     },
-    [loading, page, debouncedQuery, typeFilter, sort]
+    [loading, cursor, debouncedQuery, typeFilter, sort]
   )
 
   useEffect(() => {
@@ -91,7 +87,8 @@ const LogosApp: React.FC = () => {
     if (!ok) return
 
     try {
-      const resp = await fetch(`${API_BASE_URL}/logos/${id}`, { method: 'DELETE' })
+      const resp = await fetch(`${API_BASE_URL}/logos/${id}`, { method: 'DELETE', headers: authHeaders() })
+      if (resp.status === 401 || resp.status === 403) clearApiKey()
       if (!resp.ok) throw new Error('Delete failed')
       setLogos((prev) => prev.filter((l) => l.id !== id))
     } catch (_) {
@@ -164,7 +161,7 @@ const LogosApp: React.FC = () => {
                 <button
                   type="button"
                   onClick={() => {
-                    setPage(1)
+                    setCursor(null)
                     setTypeFilter('all')
                   }}
                   className={`px-3 py-1.5 rounded-full border text-xs ${
@@ -178,7 +175,7 @@ const LogosApp: React.FC = () => {
                 <button
                   type="button"
                   onClick={() => {
-                    setPage(1)
+                    setCursor(null)
                     setTypeFilter('football')
                   }}
                   className={`px-3 py-1.5 rounded-full border text-xs ${
@@ -192,7 +189,7 @@ const LogosApp: React.FC = () => {
                 <button
                   type="button"
                   onClick={() => {
-                    setPage(1)
+                    setCursor(null)
                     setTypeFilter('futsal')
                   }}
                   className={`px-3 py-1.5 rounded-full border text-xs ${
@@ -207,7 +204,7 @@ const LogosApp: React.FC = () => {
               <select
                 value={sort}
                 onChange={(e: React.ChangeEvent<HTMLSelectElement>) => {
-                  setPage(1)
+                  setCursor(null)
                   setSort(e.target.value as 'recent' | 'name')
                 }}
                 className="bg-dark-card border border-dark-border rounded-lg px-3 py-2 text-xs text-white focus:outline-none focus:border-accent-blue transition-smooth"
@@ -0,0 +1,22 @@
+// API key used for write requests (upload, delete). Kept in localStorage so
+// admins only have to enter it once per browser.
+const STORAGE_KEY = 'ccl_api_key'
+
+export function getApiKey(): string {
+  let key = window.localStorage.getItem(STORAGE_KEY) || ''
+  if (!key) {
+    key = (window.prompt('Zadejte API klíč') || '').trim()
+    if (key) window.localStorage.setItem(STORAGE_KEY, key)
+  }
+  return key
+}
+
+export function clearApiKey() {
+  window.localStorage.removeItem(STORAGE_KEY)
+}
+
+// authHeaders returns headers for an authenticated request
+export function authHeaders(): Record<string, string> {
+  const key = getApiKey()
+  return key ? { 'X-API-Key': key } : {}
+}
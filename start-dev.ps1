@@ -14,7 +14,7 @@ if ($dockerInstalled) {
     
     # Start backend in new window
     Write-Host "🚀 Starting Backend..." -ForegroundColor Green
-    Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd backend; go run ."
+    Start-Process powershell -ArgumentList "-NoExit", "-Command", "cd backend; go run -tags sqlite_fts5 ."
     
     # Wait a bit for backend to start
     Start-Sleep -Seconds 3